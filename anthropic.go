@@ -2,18 +2,40 @@ package aico
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/kelseyhightower/envconfig"
 )
 
+const anthropicURL = "https://api.anthropic.com/v1/messages"
+
 type AnthropicRequest struct {
-	Model       string              `json:"model"`
-	Messages    []AnthropicMessage  `json:"messages"`
-	MaxTokens   int                 `json:"max_tokens"`
-	Temperature float64             `json:"temperature"`
+	Model       string             `json:"model"`
+	Messages    []AnthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature float64            `json:"temperature"`
+	Stream      bool               `json:"stream,omitempty"`
+
+	Tools      []AnthropicTool      `json:"tools,omitempty"`
+	ToolChoice *AnthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+// AnthropicTool describes a tool the model can call. Forcing a call is how
+// structured output is obtained from the messages API.
+type AnthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type AnthropicToolChoice struct {
+	Type string `json:"type"` // "tool" forces the call of the named tool
+	Name string `json:"name,omitempty"`
 }
 
 type AnthropicMessage struct {
@@ -23,59 +45,255 @@ type AnthropicMessage struct {
 
 type AnthropicResponse struct {
 	Content []struct {
-		Type  string `json:"type"`
-		Text  string `json:"text"`
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Name  string          `json:"name"`  // Set for "tool_use" blocks
+		Input json.RawMessage `json:"input"` // Set for "tool_use" blocks
 	} `json:"content"`
 }
 
-func AskAnthropic(anthropicURL, anthropicKey, anthropicModel string, anthropicTemperature float64, anthropicMaxTokens int, question string, verbose bool) (string, error) {
-	data := AnthropicRequest{
-		Messages:    []AnthropicMessage{{Role: "user", Content: question}},
-		Model:       anthropicModel,
-		Temperature: anthropicTemperature,
-		MaxTokens:   anthropicMaxTokens,
+// AnthropicStreamEvent is a single server-sent event of a streamed message.
+type AnthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"` // Set for "input_json_delta" deltas of tool calls
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicErrorStatus maps the error types of stream error events to the
+// HTTP status the API uses for them.
+var anthropicErrorStatus = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"permission_error":      http.StatusForbidden,
+	"not_found_error":       http.StatusNotFound,
+	"rate_limit_error":      http.StatusTooManyRequests,
+	"api_error":             http.StatusInternalServerError,
+	"overloaded_error":      529,
+}
+
+// AnthropicConfig is the environment configuration of the "anthropic" provider.
+type AnthropicConfig struct {
+	Key         string  `envconfig:"ANTHROPIC_API_KEY"`
+	Model       string  `envconfig:"ANTHROPIC_MODEL" default:"claude-3-haiku-20240307"`
+	Temperature float64 `envconfig:"ANTHROPIC_TEMPERATURE" default:"0.1"`
+	MaxTokens   int     `envconfig:"ANTHROPIC_MAX_TOKENS" default:"450"`
+}
+
+// AnthropicProvider generates completions with the Anthropic messages API.
+type AnthropicProvider struct {
+	URL         string
+	Key         string
+	Model       string
+	Temperature float64
+	MaxTokens   int
+}
+
+func init() {
+	RegisterProvider("anthropic", newAnthropicProviderFromEnv)
+}
+
+func newAnthropicProviderFromEnv() (Provider, error) {
+	var cfg AnthropicConfig
+	if err := envconfig.Process("", &cfg); err != nil {
+		return nil, err
 	}
-	payloadBytes, err := json.Marshal(data)
-	if err != nil {
-		return "", err
+	if cfg.Key == "" {
+		return nil, fmt.Errorf("ANTHROPIC_API_KEY is required when MODEL_PROVIDER=anthropic")
 	}
-	body := bytes.NewReader(payloadBytes)
+	return &AnthropicProvider{
+		URL:         anthropicURL,
+		Key:         cfg.Key,
+		Model:       cfg.Model,
+		Temperature: cfg.Temperature,
+		MaxTokens:   cfg.MaxTokens,
+	}, nil
+}
 
-	req, err := http.NewRequest("POST", anthropicURL, body)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", anthropicKey)
-	req.Header.Set("Anthropic-Version", "2023-06-01")
+// Name implements Provider.
+func (p *AnthropicProvider) Name() string { return "anthropic" }
 
-	resp, err := http.DefaultClient.Do(req)
+// MaxPromptTokens implements TokenLimits.
+func (p *AnthropicProvider) MaxPromptTokens() int {
+	return modelTokenLimits{p.Model, p.MaxTokens}.MaxPromptTokens()
+}
+
+// EstimateTokens implements TokenLimits.
+func (p *AnthropicProvider) EstimateTokens(text string) int {
+	return EstimateTokens(p.Model, text)
+}
+
+// Generate implements Provider.
+func (p *AnthropicProvider) Generate(ctx context.Context, r Request) (Response, error) {
+	resp, err := p.send(ctx, p.request(r))
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("received non-OK HTTP status from Anthropic: %s, response body: %s", resp.Status, string(respBody))
+		return Response{}, err
 	}
 
-	if verbose {
+	if r.Verbose {
 		fmt.Printf("\nRaw response from Anthropic: %v", string(respBody))
 	}
 
 	var apiResp AnthropicResponse
 	if err := json.Unmarshal(respBody, &apiResp); err != nil {
-		return "", err
+		return Response{}, err
 	}
 
+	for _, content := range apiResp.Content {
+		if r.Structured && content.Type == "tool_use" && content.Name == candidatesToolName {
+			return p.structuredResponse(string(content.Input))
+		}
+	}
 	if len(apiResp.Content) > 0 && apiResp.Content[0].Type == "text" {
-		return strings.TrimSpace(apiResp.Content[0].Text), nil
+		return Response{Text: strings.TrimSpace(apiResp.Content[0].Text), Provider: p.Name()}, nil
+	}
+
+	return Response{}, fmt.Errorf("no response from Anthropic")
+}
+
+// GenerateStream implements StreamingProvider.
+func (p *AnthropicProvider) GenerateStream(ctx context.Context, r Request, onText func(string)) (Response, error) {
+	data := p.request(r)
+	data.Stream = true
+	resp, err := p.send(ctx, data)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	err = readSSE(resp.Body, func(event, data string) error {
+		var ev AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return err
+		}
+		switch ev.Type {
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				text.WriteString(ev.Delta.Text)
+				onText(ev.Delta.Text)
+			case "input_json_delta":
+				text.WriteString(ev.Delta.PartialJSON)
+				onText(ev.Delta.PartialJSON)
+			}
+		case "error":
+			// The HTTP status was already 200, report the error as the status it stands for
+			return &APIError{
+				Provider:   "Anthropic",
+				StatusCode: anthropicErrorStatus[ev.Error.Type],
+				Status:     ev.Error.Type + " event in stream",
+				Body:       data,
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Response{}, err
+	}
+
+	if r.Verbose {
+		fmt.Printf("\nRaw streamed response from Anthropic: %v", text.String())
+	}
+
+	if text.Len() == 0 {
+		return Response{}, fmt.Errorf("no response from Anthropic")
+	}
+	if r.Structured {
+		return p.structuredResponse(text.String())
+	}
+	return Response{Text: strings.TrimSpace(text.String()), Provider: p.Name()}, nil
+}
+
+// structuredResponse builds the Response of a forced tool call from its JSON input.
+func (p *AnthropicProvider) structuredResponse(input string) (Response, error) {
+	candidates, err := parseCandidates(input)
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{Text: strings.TrimSpace(input), Candidates: candidates, Provider: p.Name()}, nil
+}
+
+func (p *AnthropicProvider) request(r Request) AnthropicRequest {
+	data := AnthropicRequest{
+		Messages:    anthropicMessages(r),
+		Model:       p.Model,
+		Temperature: p.Temperature,
+		MaxTokens:   p.MaxTokens,
 	}
+	if r.Structured {
+		data.Tools = []AnthropicTool{{
+			Name:        candidatesToolName,
+			Description: "Record the generated commit message candidates.",
+			InputSchema: candidatesSchema,
+		}}
+		data.ToolChoice = &AnthropicToolChoice{Type: "tool", Name: candidatesToolName}
+	}
+	return data
+}
+
+// anthropicMessages returns the conversation of r as messages API messages.
+func anthropicMessages(r Request) []AnthropicMessage {
+	var messages []AnthropicMessage
+	for _, m := range r.conversation() {
+		messages = append(messages, AnthropicMessage{Role: m.Role, Content: m.Content})
+	}
+	return messages
+}
 
-	return "", fmt.Errorf("no response from Anthropic")
+// send posts a messages request and returns the response once it is known
+// to be successful. The caller must close its body.
+func (p *AnthropicProvider) send(ctx context.Context, data AnthropicRequest) (*http.Response, error) {
+	payloadBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	body := bytes.NewReader(payloadBytes)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", p.Key)
+	req.Header.Set("Anthropic-Version", "2023-06-01")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError("Anthropic", resp, respBody)
+	}
+	return resp, nil
+}
+
+// AskAnthropic sends a conversation, ending with the question, to the Anthropic messages API.
+func AskAnthropic(ctx context.Context, anthropicURL, anthropicKey, anthropicModel string, anthropicTemperature float64, anthropicMaxTokens int, messages []Message, verbose bool) (string, error) {
+	p := &AnthropicProvider{
+		URL:         anthropicURL,
+		Key:         anthropicKey,
+		Model:       anthropicModel,
+		Temperature: anthropicTemperature,
+		MaxTokens:   anthropicMaxTokens,
+	}
+	resp, err := p.Generate(ctx, Request{Messages: messages, Verbose: verbose})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
 }
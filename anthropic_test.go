@@ -1,10 +1,13 @@
 package aico
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestAskAnthropic(t *testing.T) {
@@ -58,12 +61,13 @@ func TestAskAnthropic(t *testing.T) {
 
 	// Call the function
 	response, err := AskAnthropic(
+		context.Background(),
 		server.URL,
 		"test-key",
 		"claude-test-model",
 		0.2,
 		300,
-		"test question",
+		[]Message{{Role: "user", Content: "test question"}},
 		false,
 	)
 
@@ -86,12 +90,13 @@ func TestAskAnthropicError(t *testing.T) {
 
 	// Call the function
 	_, err := AskAnthropic(
+		context.Background(),
 		server.URL,
 		"test-key",
 		"claude-test-model",
 		0.2,
 		300,
-		"test question",
+		[]Message{{Role: "user", Content: "test question"}},
 		false,
 	)
 
@@ -100,3 +105,94 @@ func TestAskAnthropicError(t *testing.T) {
 		t.Error("Expected an error, got nil")
 	}
 }
+
+func TestAnthropicProviderStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody AnthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Error("Failed to parse request body:", err)
+		}
+		if !reqBody.Stream {
+			t.Error("Expected stream to be true")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: message_start\ndata: {\"type\": \"message_start\"}\n\n" +
+			"event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"delta\": {\"type\": \"text_delta\", \"text\": \"- Add \"}}\n\n" +
+			"event: ping\ndata: {\"type\": \"ping\"}\n\n" +
+			"event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"delta\": {\"type\": \"text_delta\", \"text\": \"tests\\n\"}}\n\n" +
+			"event: message_stop\ndata: {\"type\": \"message_stop\"}\n\n"))
+	}))
+	defer server.Close()
+
+	p := &AnthropicProvider{URL: server.URL, Key: "test-key", Model: "claude-test-model"}
+	var chunks []string
+	resp, err := p.GenerateStream(context.Background(), Request{Prompt: "test question"}, func(text string) {
+		chunks = append(chunks, text)
+	})
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if resp.Text != "- Add tests" {
+		t.Errorf("Expected response to be '- Add tests', got: %q", resp.Text)
+	}
+	if len(chunks) != 2 || chunks[0] != "- Add " || chunks[1] != "tests\n" {
+		t.Errorf("Unexpected chunks: %q", chunks)
+	}
+}
+
+func TestAnthropicProviderStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: error\ndata: {\"type\": \"error\", \"error\": {\"type\": \"overloaded_error\", \"message\": \"Overloaded\"}}\n\n"))
+	}))
+	defer server.Close()
+
+	p := &AnthropicProvider{URL: server.URL, Key: "test-key", Model: "claude-test-model"}
+	if _, err := p.GenerateStream(context.Background(), Request{Prompt: "test question"}, func(string) {}); err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
+
+func TestAskAnthropicCancelled(t *testing.T) {
+	// Create a mock server that never answers in time
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := AskAnthropic(ctx, server.URL, "test-key", "claude-test-model", 0.2, 300, []Message{{Role: "user", Content: "test question"}}, false)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestAnthropicProviderStructured(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody AnthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Error("Failed to parse request body:", err)
+		}
+		if len(reqBody.Tools) != 1 || reqBody.ToolChoice == nil || reqBody.ToolChoice.Name != reqBody.Tools[0].Name {
+			t.Errorf("Expected a forced tool call, got tools %+v and tool_choice %+v", reqBody.Tools, reqBody.ToolChoice)
+		}
+
+		w.Write([]byte(`{"content": [{"type": "tool_use", "id": "toolu_1", "name": "` + reqBody.Tools[0].Name + `",
+			"input": {"candidates": [{"subject": "Fix crash on login", "body": "", "type": "fix", "scope": "auth"}]}}]}`))
+	}))
+	defer server.Close()
+
+	p := &AnthropicProvider{URL: server.URL, Key: "test-key", Model: "claude-test-model"}
+	resp, err := p.Generate(context.Background(), Request{Prompt: "test question", Structured: true})
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	want := Candidate{Subject: "Fix crash on login", Type: "fix", Scope: "auth"}
+	if len(resp.Candidates) != 1 || resp.Candidates[0] != want {
+		t.Errorf("Unexpected candidates: %+v", resp.Candidates)
+	}
+}
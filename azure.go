@@ -0,0 +1,106 @@
+package aico
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// AzureOpenAIConfig is the environment configuration of the "azure" provider.
+type AzureOpenAIConfig struct {
+	Endpoint    string  `envconfig:"AZURE_OPENAI_ENDPOINT"` // e.g. https://my-resource.openai.azure.com
+	Key         string  `envconfig:"AZURE_OPENAI_API_KEY"`
+	Deployment  string  `envconfig:"AZURE_OPENAI_DEPLOYMENT"`
+	APIVersion  string  `envconfig:"AZURE_OPENAI_API_VERSION" default:"2024-10-21"`
+	Temperature float64 `envconfig:"AZURE_OPENAI_TEMPERATURE" default:"0.1"`
+	MaxTokens   int     `envconfig:"AZURE_OPENAI_MAX_TOKENS" default:"450"`
+}
+
+// AzureOpenAIProvider generates completions with an Azure OpenAI deployment.
+// Azure speaks the OpenAI wire format but addresses models by deployment
+// and authenticates with an api-key header.
+type AzureOpenAIProvider struct {
+	Endpoint    string
+	Key         string
+	Deployment  string
+	APIVersion  string
+	Temperature float64
+	MaxTokens   int
+}
+
+func init() {
+	RegisterProvider("azure", newAzureOpenAIProviderFromEnv)
+}
+
+func newAzureOpenAIProviderFromEnv() (Provider, error) {
+	var cfg AzureOpenAIConfig
+	if err := envconfig.Process("", &cfg); err != nil {
+		return nil, err
+	}
+	switch {
+	case cfg.Endpoint == "":
+		return nil, fmt.Errorf("AZURE_OPENAI_ENDPOINT is required when MODEL_PROVIDER=azure")
+	case cfg.Key == "":
+		return nil, fmt.Errorf("AZURE_OPENAI_API_KEY is required when MODEL_PROVIDER=azure")
+	case cfg.Deployment == "":
+		return nil, fmt.Errorf("AZURE_OPENAI_DEPLOYMENT is required when MODEL_PROVIDER=azure")
+	}
+	return &AzureOpenAIProvider{
+		Endpoint:    cfg.Endpoint,
+		Key:         cfg.Key,
+		Deployment:  cfg.Deployment,
+		APIVersion:  cfg.APIVersion,
+		Temperature: cfg.Temperature,
+		MaxTokens:   cfg.MaxTokens,
+	}, nil
+}
+
+// Name implements Provider.
+func (p *AzureOpenAIProvider) Name() string { return "azure" }
+
+// chatURL returns the chat completions URL of the deployment.
+func (p *AzureOpenAIProvider) chatURL() string {
+	return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		strings.TrimRight(p.Endpoint, "/"), url.PathEscape(p.Deployment), url.QueryEscape(p.APIVersion))
+}
+
+// MaxPromptTokens implements TokenLimits.
+func (p *AzureOpenAIProvider) MaxPromptTokens() int {
+	return modelTokenLimits{p.Deployment, p.MaxTokens}.MaxPromptTokens()
+}
+
+// EstimateTokens implements TokenLimits.
+func (p *AzureOpenAIProvider) EstimateTokens(text string) int {
+	return EstimateTokens(p.Deployment, text)
+}
+
+// Generate implements Provider.
+func (p *AzureOpenAIProvider) Generate(ctx context.Context, r Request) (Response, error) {
+	data := OpenAIRequest{
+		Messages:    openAIMessages(r),
+		Model:       p.Deployment,
+		Temperature: p.Temperature,
+		MaxTokens:   p.MaxTokens,
+	}
+	if r.Structured {
+		data.ResponseFormat = candidatesResponseFormat()
+	}
+	headers := map[string]string{"api-key": p.Key}
+
+	apiResp, err := postOpenAIChat(ctx, p.Name(), p.chatURL(), headers, data, r.Verbose)
+	if dropResponseFormat(p.Name(), &data, err, r.Verbose) {
+		apiResp, err = postOpenAIChat(ctx, p.Name(), p.chatURL(), headers, data, r.Verbose)
+	}
+	if err != nil {
+		return Response{}, err
+	}
+
+	if len(apiResp.Choices) > 0 && apiResp.Choices[0].Message.Role == "assistant" {
+		return newOpenAIResponse(p.Name(), apiResp.Choices[0].Message.Content, data.ResponseFormat != nil)
+	}
+
+	return Response{}, fmt.Errorf("no response from Azure OpenAI")
+}
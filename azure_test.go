@@ -0,0 +1,66 @@
+package aico
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAzureOpenAIProvider(t *testing.T) {
+	// Create a mock server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/gpt-test-deployment/chat/completions" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("api-version") != "2024-10-21" {
+			t.Errorf("Unexpected api-version: %s", r.URL.Query().Get("api-version"))
+		}
+		if r.Header.Get("api-key") != "test-key" {
+			t.Error("api-key header not set correctly")
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Error("Expected no Authorization header")
+		}
+
+		var reqBody OpenAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Error("Failed to parse request body:", err)
+		}
+		if len(reqBody.Messages) != 3 || reqBody.Messages[1].Role != "assistant" || reqBody.Messages[2].Content != "shorter" {
+			t.Errorf("Unexpected messages field: %v", reqBody.Messages)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "test response"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	p := &AzureOpenAIProvider{
+		Endpoint:   server.URL + "/",
+		Key:        "test-key",
+		Deployment: "gpt-test-deployment",
+		APIVersion: "2024-10-21",
+	}
+	messages := []Message{
+		{Role: "user", Content: "test question"},
+		{Role: "assistant", Content: "- Add a long commit message"},
+	}
+	resp, err := p.Generate(context.Background(), Request{Prompt: "shorter", Messages: messages})
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if resp.Text != "test response" {
+		t.Errorf("Expected response to be 'test response', got: %s", resp.Text)
+	}
+}
+
+func TestAzureOpenAIProviderMissingDeployment(t *testing.T) {
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "https://example.openai.azure.com")
+	t.Setenv("AZURE_OPENAI_API_KEY", "test-key")
+	t.Setenv("AZURE_OPENAI_DEPLOYMENT", "")
+	if _, err := NewProvider("azure"); err == nil {
+		t.Error("Expected an error for missing AZURE_OPENAI_DEPLOYMENT, got nil")
+	}
+}
@@ -0,0 +1,151 @@
+package aico
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TruncatedDiff is a diff fitted into a token budget by TruncateDiff.
+type TruncatedDiff struct {
+	Diff         string
+	Tokens       int // Estimated tokens of Diff
+	ElidedHunks  int // Hunks whose lines were left out
+	ElidedFiles  int // Files left out entirely and listed as stat lines instead
+	ElidedTokens int // Estimated tokens that were left out
+}
+
+// Truncated reports whether anything was left out.
+func (t TruncatedDiff) Truncated() bool {
+	return t.ElidedHunks > 0 || t.ElidedFiles > 0
+}
+
+// TruncateDiff fits a git diff into budget tokens as estimated by estimate.
+// The file headers and the hunks that carry the most changed lines per token
+// are kept; the lines of the other hunks are left out, keeping only their
+// "@@" headers, and files without any kept hunk are summarised as
+// `git diff --stat` lines. The result may still exceed the budget if even the
+// summary does not fit.
+func TruncateDiff(diff string, budget int, estimate func(string) int) TruncatedDiff {
+	total := estimate(diff)
+	if total <= budget {
+		return TruncatedDiff{Diff: diff, Tokens: total}
+	}
+
+	files := ParseDiff(diff)
+	if len(files) == 0 {
+		return TruncatedDiff{Diff: diff, Tokens: total}
+	}
+
+	// Start with the cost of a diff that keeps no hunk lines at all
+	type candidate struct {
+		file, hunk int
+		tokens     int
+		score      float64
+	}
+	var hunks []candidate
+	used := 0
+	for i, f := range files {
+		used += estimate(strings.Join(f.Header, "\n") + "\n")
+		for j, h := range f.Hunks {
+			tokens := estimate(h.String())
+			used += estimate(h.Header + "\n")
+			hunks = append(hunks, candidate{file: i, hunk: j, tokens: tokens, score: float64(informativeLines(h)) / float64(tokens+1)})
+		}
+	}
+	used += estimate(DiffStat(files))
+
+	// Keep the densest hunks while they fit
+	sort.SliceStable(hunks, func(a, b int) bool { return hunks[a].score > hunks[b].score })
+	kept := make(map[[2]int]bool)
+	for _, c := range hunks {
+		cost := c.tokens - estimate(files[c.file].Hunks[c.hunk].Header+"\n")
+		if used+cost <= budget {
+			used += cost
+			kept[[2]int{c.file, c.hunk}] = true
+		}
+	}
+
+	var b strings.Builder
+	var elided []FileDiff
+	result := TruncatedDiff{}
+	for i, f := range files {
+		keptAny := false
+		for j := range f.Hunks {
+			keptAny = keptAny || kept[[2]int{i, j}]
+		}
+		if !keptAny && len(f.Hunks) > 0 {
+			elided = append(elided, f)
+			result.ElidedFiles++
+			continue
+		}
+		for _, line := range f.Header {
+			b.WriteString(line + "\n")
+		}
+		for j, h := range f.Hunks {
+			if kept[[2]int{i, j}] {
+				b.WriteString(h.String())
+				continue
+			}
+			result.ElidedHunks++
+			fmt.Fprintf(&b, "%s\n[%d lines elided]\n", h.Header, len(h.Lines))
+		}
+	}
+	if len(elided) > 0 {
+		b.WriteString("\nFiles left out of the diff above (git diff --stat):\n")
+		b.WriteString(DiffStat(elided))
+	}
+
+	result.Diff = b.String()
+	result.Tokens = estimate(result.Diff)
+	result.ElidedTokens = max(0, total-result.Tokens)
+	return result
+}
+
+// informativeLines counts the added and removed lines that carry more than
+// whitespace and punctuation, such as a lone closing brace.
+func informativeLines(h Hunk) int {
+	n := 0
+	for _, line := range h.Lines {
+		if !strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "-") {
+			continue
+		}
+		if strings.ContainsFunc(line[1:], func(r rune) bool {
+			return r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r > 0x7f
+		}) {
+			n++
+		}
+	}
+	return n
+}
+
+// DiffStat formats files like `git diff --stat`.
+func DiffStat(files []FileDiff) string {
+	const maxBar = 40
+	width, most := 0, 0
+	for _, f := range files {
+		added, deleted := f.Stat()
+		width = max(width, len(f.Path))
+		most = max(most, added+deleted)
+	}
+
+	var b strings.Builder
+	totalAdded, totalDeleted := 0, 0
+	for _, f := range files {
+		added, deleted := f.Stat()
+		totalAdded += added
+		totalDeleted += deleted
+		plus, minus := added, deleted
+		if most > maxBar {
+			plus = (added*maxBar + most - 1) / most
+			minus = (deleted*maxBar + most - 1) / most
+		}
+		fmt.Fprintf(&b, " %-*s | %d %s%s\n", width, f.Path, added+deleted, strings.Repeat("+", plus), strings.Repeat("-", minus))
+	}
+	plural := "s"
+	if len(files) == 1 {
+		plural = ""
+	}
+	fmt.Fprintf(&b, " %d file%s changed, %d insertions(+), %d deletions(-)\n", len(files), plural, totalAdded, totalDeleted)
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package aico
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Candidate is a single commit message suggestion.
+type Candidate struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Type    string `json:"type"`  // Kind of change, e.g. "feat" or "fix"
+	Scope   string `json:"scope"` // Area of the code base, may be empty
+}
+
+// Message returns the commit message, with the body separated from the
+// subject by a blank line.
+func (c Candidate) Message() string {
+	subject := strings.TrimSpace(c.Subject)
+	body := strings.TrimSpace(c.Body)
+	if body == "" {
+		return subject
+	}
+	return subject + "\n\n" + body
+}
+
+// candidatesToolName is the name of the function or tool through which
+// providers return structured candidates.
+const candidatesToolName = "commit_message_candidates"
+
+// candidatesSchema is the JSON schema of a structured response. It satisfies
+// the restrictions of OpenAI's strict mode: every property is required and no
+// additional properties are allowed.
+var candidatesSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"candidates": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"subject": {"type": "string", "description": "Commit subject line"},
+					"body": {"type": "string", "description": "Commit body, empty unless a body was requested"},
+					"type": {"type": "string", "description": "Kind of change, e.g. feat, fix, docs, refactor, test, perf or chore"},
+					"scope": {"type": "string", "description": "Area of the code base that changed, empty if unclear"}
+				},
+				"required": ["subject", "body", "type", "scope"],
+				"additionalProperties": false
+			}
+		}
+	},
+	"required": ["candidates"],
+	"additionalProperties": false
+}`)
+
+// parseCandidates decodes a structured response that follows candidatesSchema.
+func parseCandidates(data string) ([]Candidate, error) {
+	var payload struct {
+		Candidates []Candidate `json:"candidates"`
+	}
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		return nil, fmt.Errorf("invalid structured response: %w", err)
+	}
+
+	var candidates []Candidate
+	for _, c := range payload.Candidates {
+		if strings.TrimSpace(c.Subject) != "" {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no commit messages found in the structured response")
+	}
+	return candidates, nil
+}
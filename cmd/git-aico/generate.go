@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	aico "github.com/komapotter/go-git-aico"
+)
+
+// maxFollowUps is the number of follow-up requests made for missing candidates.
+const maxFollowUps = 2
+
+// generator asks the provider for commit message candidates.
+type generator struct {
+	provider   aico.Provider
+	stream     bool
+	structured bool
+	verbose    bool
+	body       bool // Parse plain text responses as messages with a body, see parseBodyResponse
+	renderer   *candidateRenderer
+
+	// conventional repairs candidates into the Conventional Commits format
+	// and drops those that cannot be repaired
+	conventional bool
+	language     string // Language of the messages, see aico.RepairConventional
+
+	// history is the conversation that feedback on the candidates continues,
+	// see round. Requests are sent after it.
+	history []aico.Message
+}
+
+// generate sends prompt to the provider and returns the candidates of its response.
+func (g *generator) generate(ctx context.Context, prompt string) ([]aico.Candidate, error) {
+	request := aico.Request{Prompt: prompt, Messages: g.history, Verbose: g.verbose, Structured: g.structured}
+	var response aico.Response
+	var err error
+	if sp, ok := g.provider.(aico.StreamingProvider); ok && g.stream {
+		g.renderer.restart()
+		response, err = sp.GenerateStream(ctx, request, g.renderer.write)
+		g.renderer.flush()
+	} else {
+		response, err = g.provider.Generate(ctx, request)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if g.verbose {
+		fmt.Printf("\nCandidates generated by: %s\n", response.Provider)
+	}
+
+	// Take the structured candidates, or split a plain text response into separate lines
+	candidates, err := responseCandidates(response, g.body, g.verbose)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the response: %w", err)
+	}
+	if g.conventional {
+		candidates = conventionalCandidates(candidates, g.language, g.verbose)
+	}
+	return candidates, nil
+}
+
+// round generates n candidates with prompt, asking for missing ones with
+// followUp, see complete. The prompt and the candidates are then added to the
+// history, so that the next round can refer to them.
+func (g *generator) round(ctx context.Context, prompt string, n int, followUp func(missing int, existing []string) (string, error)) ([]aico.Candidate, error) {
+	candidates, err := g.generate(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err = g.complete(ctx, candidates, n, followUp)
+	if err != nil {
+		return nil, err
+	}
+	g.history = append(g.history,
+		aico.Message{Role: "user", Content: prompt},
+		aico.Message{Role: "assistant", Content: formatCandidates(candidates, g.body)})
+	return candidates, nil
+}
+
+// formatCandidates formats candidates the way the prompt asks for them: as
+// "- " lines, or separated by "---" lines if they have a body.
+func formatCandidates(candidates []aico.Candidate, body bool) string {
+	lines := make([]string, len(candidates))
+	for i, c := range candidates {
+		if body {
+			lines[i] = c.Message()
+		} else {
+			lines[i] = "- " + c.Message()
+		}
+	}
+	if body {
+		return strings.Join(lines, "\n---\n")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// conventionalCandidates returns the candidates repaired into the Conventional
+// Commits format, leaving out those that cannot be repaired.
+func conventionalCandidates(candidates []aico.Candidate, language string, verbose bool) []aico.Candidate {
+	var valid []aico.Candidate
+	for _, c := range candidates {
+		repaired, err := aico.RepairConventional(c, language)
+		if err != nil {
+			if verbose {
+				fmt.Println("Dropping candidate:", err)
+			}
+			continue
+		}
+		valid = append(valid, repaired)
+	}
+	return valid
+}
+
+// complete makes sure there are exactly n candidates. Surplus candidates are
+// dropped; missing ones are asked for with the prompt returned by followUp,
+// which must exclude the subjects of the existing messages. If the follow-up
+// requests fail or still come up short, the candidates gathered so far are
+// returned; only the cancellation of ctx and errors of followUp are reported.
+func (g *generator) complete(ctx context.Context, candidates []aico.Candidate, n int, followUp func(missing int, existing []string) (string, error)) ([]aico.Candidate, error) {
+	for i := 0; i < maxFollowUps && len(candidates) < n; i++ {
+		missing := n - len(candidates)
+		if g.verbose {
+			fmt.Printf("Expected %d commit message candidates, but got %d; asking for %d more\n", n, len(candidates), missing)
+		}
+
+		existing := make([]string, len(candidates))
+		for j, c := range candidates {
+			existing[j] = strings.TrimSpace(c.Subject)
+		}
+		prompt, err := followUp(missing, existing)
+		if err != nil {
+			return nil, err
+		}
+		more, err := g.generate(ctx, prompt)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			if g.verbose {
+				fmt.Println("Error asking for more candidates:", err)
+			}
+			break
+		}
+		candidates = appendNew(candidates, more)
+	}
+
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates, nil
+}
+
+// appendNew appends the candidates of more whose message is not in candidates yet.
+func appendNew(candidates, more []aico.Candidate) []aico.Candidate {
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		seen[strings.ToLower(c.Message())] = true
+	}
+	for _, c := range more {
+		key := strings.ToLower(c.Message())
+		if !seen[key] {
+			seen[key] = true
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
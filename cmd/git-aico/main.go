@@ -2,11 +2,18 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
@@ -14,63 +21,162 @@ import (
 	aico "github.com/komapotter/go-git-aico"
 )
 
-const (
-	openAIURL    = "https://api.openai.com/v1/chat/completions"
-	anthropicURL = "https://api.anthropic.com/v1/messages"
-)
-
+// Config holds the general configuration. Provider specific settings such as
+// OPENAI_API_KEY are read by the provider itself, see aico.RegisterProvider.
 type Config struct {
-	// API Keys
-	OpenAIKey     string `envconfig:"OPENAI_API_KEY"`
-	AnthropicKey  string `envconfig:"ANTHROPIC_API_KEY"`
-	
-	// General config
-	NumCandidates int     `envconfig:"NUM_CANDIDATES" default:"3"`
-	ModelProvider string  `envconfig:"MODEL_PROVIDER" default:"openai"` // "openai" or "anthropic"
-	
-	// OpenAI config
-	OpenAIModel       string  `envconfig:"OPENAI_MODEL" default:"gpt-4o"`
-	OpenAITemperature float64 `envconfig:"OPENAI_TEMPERATURE" default:"0.1"`
-	OpenAIMaxTokens   int     `envconfig:"OPENAI_MAX_TOKENS" default:"450"`
-	
-	// Anthropic config
-	AnthropicModel       string  `envconfig:"ANTHROPIC_MODEL" default:"claude-3-haiku-20240307"`
-	AnthropicTemperature float64 `envconfig:"ANTHROPIC_TEMPERATURE" default:"0.1"`
-	AnthropicMaxTokens   int     `envconfig:"ANTHROPIC_MAX_TOKENS" default:"450"`
+	NumCandidates   int               `envconfig:"NUM_CANDIDATES" default:"3"`
+	Language        string            `envconfig:"AICO_LANGUAGE" default:"en"`           // BCP 47 tag of the language of the messages
+	ModelProvider   string            `envconfig:"MODEL_PROVIDER" default:"openai"`      // Registered provider names in fallback order, see aico.Providers
+	Stream          bool              `envconfig:"STREAM" default:"true"`                // Render candidates as they arrive, when the provider supports it
+	RequestTimeout  time.Duration     `envconfig:"REQUEST_TIMEOUT" default:"60s"`        // 0 disables the timeout
+	Structured      bool              `envconfig:"STRUCTURED_OUTPUT" default:"true"`     // Ask for JSON candidates where the provider supports it
+	DiffTokenBudget int               `envconfig:"DIFF_TOKEN_BUDGET" default:"0"`        // Tokens the diff may take up, 0 to derive it from the model
+	SummaryWorkers  int               `envconfig:"SUMMARY_WORKERS" default:"4"`          // Concurrent requests when summarising a huge diff
+	RedactStrict    bool              `envconfig:"REDACT_STRICT" default:"false"`        // Refuse to send a diff in which secrets were redacted
+	Conventional    bool              `envconfig:"CONVENTIONAL_COMMITS" default:"false"` // Ask for and enforce "type(scope): subject" messages
+	ScopeMap        map[string]string `envconfig:"SCOPE_MAP"`                            // Path prefix to scope, e.g. "services/billing:billing,web:frontend"
+	HistoryExamples int               `envconfig:"HISTORY_EXAMPLES" default:"0"`         // Commit subjects from git log shown as examples, 0 for the built-in samples
+	PromptTemplate  string            `envconfig:"PROMPT_TEMPLATE"`                      // Global prompt template, by default in the user's config directory
+	GitBackend      string            `envconfig:"GIT_BACKEND" default:"exec"`           // "exec" runs the git command, "go-git" needs no git binary
+	CommitBody      bool              `envconfig:"COMMIT_BODY" default:"false"`          // Generate a body explaining the change below the subject
+	TUI             bool              `envconfig:"AICO_TUI" default:"false"`             // Choose the message in a full-screen picker instead of the numbered prompt
+
+	// Retry of rate limited, overloaded and otherwise failed requests
+	RetryMaxAttempts int           `envconfig:"RETRY_MAX_ATTEMPTS" default:"3"`
+	RetryBaseDelay   time.Duration `envconfig:"RETRY_BASE_DELAY" default:"1s"`
+	RetryMaxDelay    time.Duration `envconfig:"RETRY_MAX_DELAY" default:"30s"`
 }
 
-var (
-	verbose        bool // Global flag to control verbose output
-	japaneseOutput bool // Global flag to control Japanese output
-)
+var verbose bool // Global flag to control verbose output
+
+// newProvider creates the providers listed in MODEL_PROVIDER, each retrying
+// on its own, and chains them so that a failing provider falls back to the next.
+// Providers that cannot be created, e.g. because their API key is missing, are
+// skipped as long as at least one remains.
+func newProvider(cfg Config) (aico.Provider, error) {
+	policy := aico.RetryPolicy{
+		MaxAttempts: cfg.RetryMaxAttempts,
+		BaseDelay:   cfg.RetryBaseDelay,
+		MaxDelay:    cfg.RetryMaxDelay,
+		Timeout:     cfg.RequestTimeout,
+	}
+
+	var providers []aico.Provider
+	var errs []error
+	for _, name := range strings.Split(cfg.ModelProvider, ",") {
+		p, err := aico.NewProvider(strings.TrimSpace(name))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		providers = append(providers, aico.WithRetry(p, policy))
+	}
+	if len(providers) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	if verbose {
+		for _, err := range errs {
+			fmt.Println("Skipping provider:", err)
+		}
+	}
+	return aico.Fallback(providers...), nil
+}
+
+// newRepository opens the current repository with the GIT_BACKEND implementation.
+func newRepository(cfg Config) (aico.Repository, error) {
+	switch cfg.GitBackend {
+	case "exec":
+		return aico.ExecRepository{}, nil
+	case "go-git":
+		return aico.OpenGoGitRepository(".")
+	default:
+		return nil, fmt.Errorf("unknown git backend: %s (supported backends: exec, go-git)", cfg.GitBackend)
+	}
+}
 
-// selectCommitMessage prompts the user to select a commit message from a list of suggestions.
-func selectCommitMessage(suggestions []string) (string, error) {
+// globalPromptTemplate returns the path of the prompt template used in
+// repositories without their own.
+func globalPromptTemplate(cfg Config) string {
+	if cfg.PromptTemplate != "" {
+		return cfg.PromptTemplate
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "git-aico", "prompt.tmpl")
+}
+
+// selection is the commit message or action chosen in selectCommitMessage.
+type selection struct {
+	message string
+	edit    bool // Open the message in the editor before committing
+
+	regenerate bool   // Generate a fresh batch of suggestions instead
+	feedback   string // Refine the suggestions according to this feedback instead
+}
+
+// selectCommitMessage prompts the user to select a commit message from a list
+// of suggestions. The body of a suggestion is indented below its subject.
+// Entering "e" before the number edits the message before it is committed,
+// "r" asks for new suggestions and "f" followed by text gives feedback on them.
+func selectCommitMessage(suggestions []string) (selection, error) {
 	fmt.Println("? Choose a commit message")
 	for i, suggestion := range suggestions {
-		fmt.Printf(" %d. %s\n", i+1, strings.TrimSpace(suggestion))
+		subject, body, hasBody := strings.Cut(strings.TrimSpace(suggestion), "\n")
+		fmt.Printf(" %d. %s\n", i+1, subject)
+		if hasBody {
+			for _, line := range strings.Split(body, "\n") {
+				fmt.Println(strings.TrimRight("    "+line, " "))
+			}
+			fmt.Println()
+		}
 	}
+	fmt.Println(`  (enter "e <number>" to edit the message before committing, "r" to regenerate`)
+	fmt.Println(`   or "f <feedback>" to refine the suggestions, e.g. "f shorter")`)
 
 	reader := bufio.NewReader(os.Stdin)
 	for {
 		fmt.Print("Enter the number of your choice: ")
 		input, err := reader.ReadString('\n')
 		if err != nil {
-			return "", err
+			return selection{}, err
 		}
 		input = strings.TrimSpace(input)
 		if input == "exit" {
 			os.Exit(0)
 		}
-		choice, err := strconv.Atoi(input)
+		if input == "r" {
+			return selection{regenerate: true}, nil
+		}
+		if feedback, ok := strings.CutPrefix(input, "f "); ok && strings.TrimSpace(feedback) != "" {
+			return selection{feedback: strings.TrimSpace(feedback)}, nil
+		}
+		number, edit := strings.CutPrefix(input, "e")
+		choice, err := strconv.Atoi(strings.TrimSpace(number))
 		if err != nil || choice < 1 || choice > len(suggestions) {
 			fmt.Println("Invalid choice, please try again.")
 			continue
 		}
-		return suggestions[choice-1], nil
+		return selection{message: suggestions[choice-1], edit: edit}, nil
 	}
 }
 
+// withSpinner runs generate with a spinner, which the renderer stops when it
+// prints the first candidate, and a context that Ctrl-C cancels. The default
+// Ctrl-C handling is restored when it returns.
+func withSpinner(renderer *candidateRenderer, generate func(ctx context.Context) ([]aico.Candidate, error)) ([]aico.Candidate, error) {
+	done := make(chan bool)
+	go startSpinner(done)
+	renderer.stopSpinner = sync.OnceFunc(func() { done <- true; <-done })
+	defer renderer.stopSpinner()
+
+	// REQUEST_TIMEOUT is applied to each request by the provider
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return generate(ctx)
+}
+
 // startSpinner starts a simple console spinner
 func startSpinner(done chan bool) {
 	spinnerChars := `|/-\`
@@ -81,6 +187,7 @@ func startSpinner(done chan bool) {
 		select {
 		case <-done:
 			fmt.Printf("\r\033[K") // Clear the entire line when done
+			done <- true           // Acknowledge, so nothing is printed before the line is cleared
 			return
 		default:
 			fmt.Printf("\r  %c %s%s", spinnerChars[i%len(spinnerChars)], "Generating commit messages ", dots)
@@ -122,6 +229,66 @@ func parseModelResponse(response string, verbose bool) ([]string, error) {
 	return messages, nil
 }
 
+// messageSeparator matches the lines between messages with a body.
+var messageSeparator = regexp.MustCompile(`(?m)^[ \t]*---+[ \t]*$`)
+
+// parseBodyResponse parses a response to a prompt asking for commit bodies,
+// in which the messages are separated by "---" lines, into candidates. The
+// first line of each message is its subject and the rest its body.
+func parseBodyResponse(response string, verbose bool) ([]aico.Candidate, error) {
+	if response == "" {
+		return nil, fmt.Errorf("response from model is empty")
+	}
+
+	var candidates []aico.Candidate
+	for _, block := range messageSeparator.Split(strings.TrimSpace(response), -1) {
+		subject, body, _ := strings.Cut(strings.TrimSpace(block), "\n")
+		subject = strings.TrimSpace(strings.TrimPrefix(subject, "- "))
+		if subject != "" {
+			candidates = append(candidates, aico.Candidate{Subject: subject, Body: strings.TrimSpace(body)})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no commit messages found in the response")
+	}
+
+	if verbose {
+		fmt.Println("Candidate messages:")
+		for _, c := range candidates {
+			fmt.Printf("msg: %v\n", c.Message())
+		}
+	}
+	return candidates, nil
+}
+
+// responseCandidates returns the candidates of a structured response, falling
+// back to parseModelResponse, or parseBodyResponse if bodies were asked for,
+// for providers that answered with plain text.
+func responseCandidates(response aico.Response, body, verbose bool) ([]aico.Candidate, error) {
+	if len(response.Candidates) == 0 && body {
+		return parseBodyResponse(response.Text, verbose)
+	}
+	if len(response.Candidates) == 0 {
+		messages, err := parseModelResponse(response.Text, verbose)
+		if err != nil {
+			return nil, err
+		}
+		candidates := make([]aico.Candidate, len(messages))
+		for i, message := range messages {
+			candidates[i] = aico.Candidate{Subject: message}
+		}
+		return candidates, nil
+	}
+
+	if verbose {
+		fmt.Println("Candidate messages:")
+		for _, c := range response.Candidates {
+			fmt.Printf("msg: %v (type: %q, scope: %q)\n", c.Message(), c.Type, c.Scope)
+		}
+	}
+	return response.Candidates, nil
+}
+
 func printHelp() {
 	helpText := `
 Usage: git-aico [options]
@@ -129,23 +296,110 @@ Usage: git-aico [options]
 Options:
   -h        Show this help message
   -v        Enable verbose output
-  -j        Output commit message suggestions in Japanese
+  -lang tag Language of the commit message suggestions as a BCP 47 tag: en, ja, ko, de or es,
+            or any other language with a prompt template
+  -j        Output commit message suggestions in Japanese, same as -lang ja
+  -history n
+            Follow the style of the last n commit subjects of the current branch
+  -conventional
+            Generate Conventional Commits messages such as "feat(api): add endpoint"
+  -body     Generate a body explaining why the change was made below each subject line
+  -tui      Choose the commit message in a full-screen picker: arrow keys move, enter
+            commits, e edits inline, tab toggles a pane with the staged diff and ←/→
+            switch its file; the numbered prompt is used when stdin is not a terminal
+  -allow-secrets
+            Send the redacted diff even if REDACT_STRICT is set
+
+Enter "e <number>" instead of the number of a suggestion to edit it before committing, in
+GIT_EDITOR, core.editor, VISUAL or EDITOR, like "git commit -e". Enter "r" for a fresh batch
+of suggestions, or "f <feedback>" such as "f mention the migration" to have them refined.
 
 Environment Variables:
-  MODEL_PROVIDER       Model provider to use: "openai" or "anthropic" (default: openai)
+  MODEL_PROVIDER       Model provider to use: "openai", "openai-compatible", "azure",
+                       "anthropic", "gemini" or "ollama" (default: openai)
+                       A comma separated list such as "anthropic,openai,ollama"
+                       falls back to the next provider when one fails
+  AICO_LANGUAGE        Language of the commit message suggestions, like -lang (default: en)
   NUM_CANDIDATES       Number of commit message candidates to generate (default: 3)
+  STREAM               Show candidates while they are generated (default: true)
+  REQUEST_TIMEOUT      Give up on a request after this duration, 0 to wait forever (default: 60s)
+  STRUCTURED_OUTPUT    Ask for JSON candidates instead of parsing "- " lines, where the
+                       provider supports it (default: true)
+  DIFF_TOKEN_BUDGET    Tokens the staged diff may take up before hunks are left out,
+                       0 to derive it from the model's context window (default: 0)
+  SUMMARY_WORKERS      Concurrent requests when a diff too large even when truncated is
+                       summarised part by part (default: 4)
+  CONVENTIONAL_COMMITS Always generate Conventional Commits messages, like -conventional
+                       (default: false)
+  SCOPE_MAP            Scopes of path prefixes for Conventional Commits messages, e.g.
+                       "services/billing:billing,web:frontend"; otherwise the scope is
+                       inferred from the Go package or directory of the staged files
+  AICO_TUI             Always choose the commit message in the full-screen picker, like -tui
+                       (default: false)
+  COMMIT_BODY          Always generate a body below the subject line, like -body; consider
+                       raising the MAX_TOKENS setting of the provider (default: false)
+  HISTORY_EXAMPLES     Number of recent commit subjects shown to the model instead of the
+                       built-in samples, like -history; 0 disables it (default: 0)
+  PROMPT_TEMPLATE      Prompt template used in repositories without a .aico/prompt.tmpl
+                       (default: git-aico/prompt.tmpl in the user's config directory)
+  GIT_BACKEND          "exec" runs the git command, "go-git" reads and commits without a
+                       git binary but runs no hooks (default: exec)
+  REDACT_STRICT        Refuse to send a diff in which possible secrets were redacted,
+                       unless -allow-secrets is given (default: false)
+  RETRY_MAX_ATTEMPTS   Attempts for rate limited or failed requests, 1 disables retries (default: 3)
+  RETRY_BASE_DELAY     Backoff before the first retry, doubled for each further one (default: 1s)
+  RETRY_MAX_DELAY      Upper bound of the backoff and of Retry-After from the server (default: 30s)
 
   # OpenAI Configuration
   OPENAI_API_KEY       Your OpenAI API key (required when MODEL_PROVIDER=openai)
   OPENAI_MODEL         OpenAI model to use (default: gpt-4o)
   OPENAI_TEMPERATURE   Sampling temperature (default: 0.1)
   OPENAI_MAX_TOKENS    Maximum number of tokens in the response (default: 450)
+  OPENAI_BASE_URL      API base URL (default: https://api.openai.com/v1)
+  OPENAI_EXTRA_HEADERS Extra request headers, e.g. "X-Title:git-aico,X-Env:dev"
+
+  # OpenAI-compatible Server Configuration
+  OPENAI_COMPATIBLE_BASE_URL      API base URL, e.g. http://localhost:8000/v1 (required)
+  OPENAI_COMPATIBLE_MODEL         Model to use (required)
+  OPENAI_COMPATIBLE_API_KEY       API key, if the server needs one
+  OPENAI_COMPATIBLE_TEMPERATURE   Sampling temperature (default: 0.1)
+  OPENAI_COMPATIBLE_MAX_TOKENS    Maximum number of tokens in the response (default: 450)
+  OPENAI_COMPATIBLE_EXTRA_HEADERS Extra request headers, e.g. "X-Title:git-aico"
+
+  # Azure OpenAI Configuration
+  AZURE_OPENAI_ENDPOINT    Resource endpoint, e.g. https://my-resource.openai.azure.com
+  AZURE_OPENAI_API_KEY     Your Azure OpenAI API key (required when MODEL_PROVIDER=azure)
+  AZURE_OPENAI_DEPLOYMENT  Name of the model deployment
+  AZURE_OPENAI_API_VERSION API version (default: 2024-10-21)
+  AZURE_OPENAI_TEMPERATURE Sampling temperature (default: 0.1)
+  AZURE_OPENAI_MAX_TOKENS  Maximum number of tokens in the response (default: 450)
 
   # Anthropic Configuration
   ANTHROPIC_API_KEY    Your Anthropic API key (required when MODEL_PROVIDER=anthropic)
   ANTHROPIC_MODEL      Anthropic model to use (default: claude-3-haiku-20240307)
   ANTHROPIC_TEMPERATURE Sampling temperature (default: 0.1)
   ANTHROPIC_MAX_TOKENS Maximum number of tokens in the response (default: 450)
+
+  # Gemini Configuration
+  GEMINI_API_KEY       Your Gemini API key (required when MODEL_PROVIDER=gemini)
+  GEMINI_MODEL         Gemini model to use (default: gemini-1.5-flash)
+  GEMINI_TEMPERATURE   Sampling temperature (default: 0.1)
+  GEMINI_MAX_TOKENS    Maximum number of tokens in the response (default: 450)
+
+  # Ollama Configuration
+  OLLAMA_HOST          Address of the Ollama server (default: http://localhost:11434)
+  OLLAMA_MODEL         Ollama model to use (default: llama3.1)
+  OLLAMA_TEMPERATURE   Sampling temperature (default: 0.1)
+  OLLAMA_MAX_TOKENS    Maximum number of tokens in the response (default: 450)
+  OLLAMA_NUM_CTX       Context window size in tokens (default: 8192)
+
+Files:
+  .aico/prompt.tmpl    Go text/template replacing the built-in prompt, in the repository root
+  .aicoignore          Patterns in gitignore syntax, in the repository root, of files whose
+                       diff is replaced with a one-line stub; lockfiles, generated code
+                       and vendor/ are ignored by default
+  .aicoredact          Regular expressions, one per line, of secrets to redact in addition
+                       to AWS keys, GitHub tokens, private keys and other random-looking tokens
 `
 	fmt.Println(helpText)
 }
@@ -159,7 +413,13 @@ func main() {
 	}
 
 	flag.BoolVar(&verbose, "v", false, "Enable verbose output")
-	flag.BoolVar(&japaneseOutput, "j", false, "Output commit message suggestions in Japanese")
+	language := flag.String("lang", "", "Language of the commit message suggestions as a BCP 47 `tag`, e.g. ko or de")
+	japanese := flag.Bool("j", false, "Output commit message suggestions in Japanese, same as -lang ja")
+	conventional := flag.Bool("conventional", false, "Generate Conventional Commits messages")
+	body := flag.Bool("body", false, "Generate a body explaining the change below each subject line")
+	tui := flag.Bool("tui", false, "Choose the commit message in a full-screen picker with a diff preview")
+	history := flag.Int("history", 0, "Follow the style of the last `n` commit subjects of the branch")
+	allowSecrets := flag.Bool("allow-secrets", false, "Send the redacted diff even if REDACT_STRICT is set")
 	showHelp := flag.Bool("h", false, "Show this help message")
 
 	flag.Parse()
@@ -168,88 +428,269 @@ func main() {
 		printHelp()
 		return
 	}
+	switch {
+	case *language != "":
+		cfg.Language = *language
+	case *japanese:
+		cfg.Language = "ja"
+	}
+	promptOptions := aico.PromptOptions{
+		NumCandidates: cfg.NumCandidates,
+		Language:      cfg.Language,
+		Conventional:  cfg.Conventional || *conventional,
+		Body:          cfg.CommitBody || *body,
+	}
 
-	// Validate required API keys based on selected provider
-	switch cfg.ModelProvider {
-	case "openai":
-		if cfg.OpenAIKey == "" {
-			fmt.Println("Error: OPENAI_API_KEY is required when MODEL_PROVIDER=openai")
-			return
-		}
-	case "anthropic":
-		if cfg.AnthropicKey == "" {
-			fmt.Println("Error: ANTHROPIC_API_KEY is required when MODEL_PROVIDER=anthropic")
-			return
-		}
-	default:
-		fmt.Printf("Error: Unknown model provider: %s. Supported providers are 'openai' and 'anthropic'\n", cfg.ModelProvider)
+	// Create the providers; this also validates their required configuration
+	provider, err := newProvider(cfg)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	repo, err := newRepository(cfg)
+	if err != nil {
+		fmt.Println("Error opening the repository:", err)
+		return
+	}
+
+	// Load the patterns of the files whose diff is not sent to the model
+	root, err := repo.Root()
+	if err != nil {
+		fmt.Println("Error finding the repository root:", err)
+		return
+	}
+	ignoreRules, err := aico.LoadIgnoreRules(root)
+	if err != nil {
+		fmt.Println("Error loading", aico.IgnoreFile+":", err)
+		return
+	}
+	redactor, err := aico.LoadRedactor(root)
+	if err != nil {
+		fmt.Println("Error loading", aico.RedactFile+":", err)
+		return
+	}
+	promptOptions.Template, err = aico.LoadPromptTemplate(filepath.Join(root, aico.PromptTemplateFile), globalPromptTemplate(cfg))
+	if err != nil {
+		fmt.Println("Error loading the prompt template:", err)
+		return
+	}
+	if promptOptions.Template == nil && !aico.SupportsLanguage(cfg.Language) {
+		fmt.Printf("Error: there is no built-in prompt for the language %q (supported languages: %s); write a prompt template to use it\n",
+			cfg.Language, strings.Join(aico.Languages(), ", "))
 		return
 	}
 
 	// Execute git diff and get the output
-	diffOutput, err := aico.ExecuteGitDiffStaged()
+	stagedDiff, err := repo.StagedDiff()
 	if err != nil {
 		fmt.Println("Error reading diff:", err)
 		return
 	}
+	diffOutput := ignoreRules.FilterDiff(stagedDiff)
 
 	if diffOutput == "" {
 		fmt.Println("No changes detected")
 		return
 	}
 
-	// Start the spinner
-	done := make(chan bool)
-	go startSpinner(done)
+	promptOptions.FileList, err = repo.StagedFiles()
+	if err != nil {
+		fmt.Println("Error listing the staged files:", err)
+		return
+	}
+	if promptOptions.Branch, err = repo.CurrentBranch(); err != nil && verbose {
+		fmt.Println("Error reading the current branch:", err)
+	}
 
-	// Create a question based on the diff output
-	question := aico.CreateAIQuestion(diffOutput, cfg.NumCandidates, japaneseOutput)
+	// Suggest a scope derived from the staged paths, so that it does not vary between runs
+	if promptOptions.Conventional {
+		promptOptions.Scope = aico.InferScope(root, promptOptions.FileList, cfg.ScopeMap)
+		if verbose && promptOptions.Scope != "" {
+			fmt.Println("Inferred scope:", promptOptions.Scope)
+		}
+	}
 
-	var response string
-	// Call the appropriate API based on the selected provider
-	if cfg.ModelProvider == "openai" {
+	// Show the style of the repository instead of the built-in samples
+	if *history > 0 {
+		cfg.HistoryExamples = *history
+	}
+	if cfg.HistoryExamples > 0 {
+		promptOptions.RecentCommits, err = aico.HistoryExamples(repo, cfg.HistoryExamples)
+		if err != nil {
+			fmt.Println("Error reading the commit history:", err)
+			return
+		}
 		if verbose {
-			fmt.Printf("Using OpenAI model: %s\n", cfg.OpenAIModel)
+			fmt.Printf("Using %d commit subjects from the history as examples\n", len(promptOptions.RecentCommits))
 		}
-		response, err = aico.AskOpenAI(openAIURL, cfg.OpenAIKey, cfg.OpenAIModel, cfg.OpenAITemperature, cfg.OpenAIMaxTokens, question, verbose)
-	} else { // anthropic
+	}
+
+	// Keep secrets from being sent to the provider
+	diffOutput, redactions := redactor.Redact(diffOutput)
+	if len(redactions) > 0 {
 		if verbose {
-			fmt.Printf("Using Anthropic model: %s\n", cfg.AnthropicModel)
+			for _, r := range redactions {
+				fmt.Printf("Redacted %s on line %d of the diff\n", r.Detector, r.Line)
+			}
 		}
-		response, err = aico.AskAnthropic(anthropicURL, cfg.AnthropicKey, cfg.AnthropicModel, cfg.AnthropicTemperature, cfg.AnthropicMaxTokens, question, verbose)
+		if cfg.RedactStrict && !*allowSecrets {
+			fmt.Printf("Error: the staged diff contains possible secrets (%s); nothing was sent. Unstage them or rerun with -allow-secrets to send the redacted diff\n",
+				aico.SummarizeRedactions(redactions))
+			return
+		}
+		fmt.Printf("Note: redacted possible secrets from the staged diff (%s)\n", aico.SummarizeRedactions(redactions))
 	}
 
-	if err != nil {
-		done <- true // Stop the spinner
-		fmt.Printf("Error asking %s: %v\n", strings.Title(cfg.ModelProvider), err)
-		return
+	// Fit the diff into the context window of the model
+	limits := aico.LimitsOf(provider)
+	budget := cfg.DiffTokenBudget
+	if budget <= 0 {
+		prompt, err := aico.CreatePrompt("", promptOptions)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		budget = limits.MaxPromptTokens() - limits.EstimateTokens(prompt)
+	}
+	fullDiff := diffOutput
+	truncated := aico.TruncateDiff(diffOutput, budget, limits.EstimateTokens)
+	if truncated.Truncated() && truncated.Tokens <= budget {
+		fmt.Printf("Note: the staged diff exceeds the budget of %d tokens; left out %d hunks and %d files (~%d tokens)\n",
+			budget, truncated.ElidedHunks, truncated.ElidedFiles, truncated.ElidedTokens)
+		diffOutput = truncated.Diff
 	}
 
-	// Stop the spinner
-	done <- true
+	if verbose {
+		fmt.Printf("Using provider: %s\n", provider.Name())
+	}
 
-	// Split the response into separate lines
-	messages, err := parseModelResponse(response, verbose)
-	if err != nil {
-		fmt.Println("Error parsing the response:", err)
-		return
+	gen := &generator{
+		provider:   provider,
+		stream:     cfg.Stream,
+		structured: cfg.Structured,
+		verbose:    verbose,
+		body:       promptOptions.Body,
+		renderer:   &candidateRenderer{out: os.Stdout, body: promptOptions.Body},
+
+		conventional: promptOptions.Conventional,
+		language:     cfg.Language,
 	}
+	var shown []string // Subjects of all suggestions so far, which regenerated ones must differ from
+	candidates, err := withSpinner(gen.renderer, func(ctx context.Context) ([]aico.Candidate, error) {
+		// Summarise diffs that do not fit even when truncated part by part, and
+		// generate the commit messages from the summaries
+		if truncated.Tokens > budget {
+			var err error
+			if diffOutput, err = aico.SummarizeDiff(ctx, provider, fullDiff, cfg.SummaryWorkers, verbose); err != nil {
+				return nil, err
+			}
+		}
 
-	// Check if the number of messages matches the expected number of candidates
-	if len(messages) != cfg.NumCandidates {
-		fmt.Printf("Error: Expected %d commit message candidates, but got %d\n", cfg.NumCandidates, len(messages))
-		return
+		// Create a question based on the diff output
+		prompt, err := aico.CreatePrompt(diffOutput, promptOptions)
+		if err != nil {
+			return nil, err
+		}
+		// Ask for missing candidates instead of giving up on a short answer
+		return gen.round(ctx, prompt, cfg.NumCandidates, func(missing int, existing []string) (string, error) {
+			opts := promptOptions
+			opts.NumCandidates = missing
+			return aico.CreateAdditionalPrompt(diffOutput, opts, existing)
+		})
+	})
+
+	var selected selection
+	for {
+		switch {
+		case errors.Is(err, context.Canceled):
+			fmt.Println("Interrupted")
+			return
+		case errors.Is(err, context.DeadlineExceeded):
+			fmt.Printf("Error asking %s: no response within %s (see REQUEST_TIMEOUT)\n", provider.Name(), cfg.RequestTimeout)
+			return
+		case errors.Is(err, aico.ErrAuth):
+			fmt.Printf("Error asking %s: the API key was rejected, check your configuration: %v\n", provider.Name(), err)
+			return
+		case err != nil:
+			fmt.Printf("Error asking %s: %v\n", provider.Name(), err)
+			return
+		case len(candidates) == 0 && promptOptions.Conventional:
+			fmt.Printf("Error asking %s: none of the generated messages follows the Conventional Commits format\n", provider.Name())
+			return
+		case len(candidates) == 0:
+			fmt.Printf("Error asking %s: no commit message candidates in the response\n", provider.Name())
+			return
+		}
+
+		messages := make([]string, len(candidates))
+		for i, c := range candidates {
+			messages[i] = c.Message()
+			shown = append(shown, strings.TrimSpace(c.Subject))
+		}
+
+		// Replace the streamed candidates with the numbered list
+		if !verbose {
+			gen.renderer.clear()
+		}
+
+		// Prompt the user to select a commit message
+		selected, err = chooseCommitMessage(messages, stagedDiff, cfg.TUI || *tui)
+		if err != nil {
+			fmt.Println("Error selecting commit message:", err)
+			return
+		}
+		if !selected.regenerate && selected.feedback == "" {
+			break
+		}
+
+		candidates, err = withSpinner(gen.renderer, func(ctx context.Context) ([]aico.Candidate, error) {
+			if selected.regenerate {
+				// Start over, but do not suggest the same messages again
+				gen.history = nil
+				prompt, err := aico.CreateAdditionalPrompt(diffOutput, promptOptions, shown)
+				if err != nil {
+					return nil, err
+				}
+				return gen.round(ctx, prompt, cfg.NumCandidates, func(missing int, existing []string) (string, error) {
+					opts := promptOptions
+					opts.NumCandidates = missing
+					return aico.CreateAdditionalPrompt(diffOutput, opts, slices.Concat(shown, existing))
+				})
+			}
+
+			// Continue the conversation, so that the feedback can refer to the suggestions
+			prompt, err := aico.CreateFeedbackPrompt(selected.feedback, promptOptions, nil)
+			if err != nil {
+				return nil, err
+			}
+			return gen.round(ctx, prompt, cfg.NumCandidates, func(missing int, existing []string) (string, error) {
+				opts := promptOptions
+				opts.NumCandidates = missing
+				return aico.CreateFeedbackPrompt(selected.feedback, opts, existing)
+			})
+		})
 	}
 
-	// Prompt the user to select a commit message
-	selectedMessage, err := selectCommitMessage(messages)
-	if err != nil {
-		fmt.Println("Error selecting commit message:", err)
-		return
+	selectedMessage := selected.message
+	if selected.edit {
+		editor, err := aico.Editor(repo)
+		if err != nil {
+			fmt.Println("Error finding the editor:", err)
+			return
+		}
+		if selectedMessage, err = aico.EditMessage(editor, selectedMessage); err != nil {
+			fmt.Println("Error editing commit message:", err)
+			return
+		}
+		if selectedMessage == "" {
+			fmt.Println("Aborting commit due to empty commit message.")
+			return
+		}
 	}
 
 	// Commit the changes with the selected commit message
-	if err := aico.CommitChanges(selectedMessage); err != nil {
+	if err := repo.Commit(selectedMessage); err != nil {
 		fmt.Println("Error committing changes:", err)
 		return
 	}
@@ -2,10 +2,16 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
 	"testing"
+
+	aico "github.com/komapotter/go-git-aico"
 )
 
 func TestSelectCommitMessage(t *testing.T) {
@@ -17,11 +23,15 @@ func TestSelectCommitMessage(t *testing.T) {
 
 	tests := []struct {
 		input    string
-		expected string
+		expected selection
 	}{
-		{"1\n", suggestions[0]},
-		{"2\n", suggestions[1]},
-		{"3\n", suggestions[2]},
+		{"1\n", selection{message: suggestions[0]}},
+		{"2\n", selection{message: suggestions[1]}},
+		{"3\n", selection{message: suggestions[2]}},
+		{"e2\n", selection{message: suggestions[1], edit: true}},
+		{"x\ne 3\n", selection{message: suggestions[2], edit: true}},
+		{"r\n", selection{regenerate: true}},
+		{"f \nf  mention the migration \n", selection{feedback: "mention the migration"}},
 	}
 
 	for _, test := range tests {
@@ -45,12 +55,12 @@ func TestSelectCommitMessage(t *testing.T) {
 			defer inW.Close()
 			_, _ = inW.Write([]byte(test.input))
 		}()
-		selectedMessage, err := selectCommitMessage(suggestions)
+		selected, err := selectCommitMessage(suggestions)
 		if err != nil {
 			t.Errorf("selectCommitMessage returned an unexpected error: %v", err)
 		}
-		if selectedMessage != test.expected {
-			t.Errorf("selectCommitMessage = %q, want %q", selectedMessage, test.expected)
+		if selected != test.expected {
+			t.Errorf("selectCommitMessage = %+v, want %+v", selected, test.expected)
 		}
 		outW.Close()
 		outBuf := new(bytes.Buffer)
@@ -108,6 +118,220 @@ func TestParseModelResponse(t *testing.T) {
 	}
 }
 
+func TestParseBodyResponse(t *testing.T) {
+	response := "Add search feature\n\nUsers could not find old posts.\n\n- web: add search box\n---\n- Fix login crash\n---\n"
+	got, err := parseBodyResponse(response, false)
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	want := []aico.Candidate{
+		{Subject: "Add search feature", Body: "Users could not find old posts.\n\n- web: add search box"},
+		{Subject: "Fix login crash"},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("parseBodyResponse() = %q, want %q", got, want)
+	}
+	if got[0].Message() != "Add search feature\n\nUsers could not find old posts.\n\n- web: add search box" {
+		t.Errorf("Unexpected message: %q", got[0].Message())
+	}
+
+	if _, err := parseBodyResponse("---\n", false); err == nil {
+		t.Error("Expected an error for a response without messages")
+	}
+}
+
+func TestCandidateRenderer(t *testing.T) {
+	var out bytes.Buffer
+	stopped := 0
+	r := &candidateRenderer{out: &out, stopSpinner: func() { stopped++ }}
+
+	r.write("- Add search")
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing printed before the line is complete, got %q", out.String())
+	}
+	r.write(" feature\n\n- Fix login")
+	r.write(" crash")
+	r.flush()
+
+	got := out.String()
+	if !strings.Contains(got, "  - Add search feature\n") || !strings.Contains(got, "  - Fix login crash\n") {
+		t.Errorf("Unexpected output: %q", got)
+	}
+	if r.lines != 2 {
+		t.Errorf("Expected 2 printed lines, got %d", r.lines)
+	}
+	if stopped == 0 {
+		t.Error("Expected the spinner to be stopped")
+	}
+
+	out.Reset()
+	r.clear()
+	if out.String() != "\033[2A\r\033[J" {
+		t.Errorf("Unexpected clear sequence: %q", out.String())
+	}
+}
+
+func TestCandidateRendererBody(t *testing.T) {
+	var out bytes.Buffer
+	r := &candidateRenderer{out: &out, stopSpinner: func() {}, body: true}
+
+	r.write("Add search feature\n\nUsers could not\n")
+	r.write("find old posts.\n\n- web: add search box\n---\n")
+	r.write("Fix login crash")
+	r.flush()
+
+	if got := out.String(); got != "\r\033[K  - Add search feature\n\r\033[K  - Fix login crash\n" {
+		t.Errorf("Expected only the subjects, got %q", got)
+	}
+}
+
+func TestCandidateRendererStructured(t *testing.T) {
+	var out bytes.Buffer
+	r := &candidateRenderer{out: &out, stopSpinner: func() {}}
+
+	r.write(`{"candidates": [{"subject": "Add search`)
+	r.write(` feature", "body": "", "type": "feat", "scope": ""}, {"subj`)
+	r.write(`ect": "Fix \"login\" crash", "body": ""`)
+	r.write(`}]}`)
+	r.flush()
+
+	got := out.String()
+	if !strings.Contains(got, "  - Add search feature\n") || !strings.Contains(got, "  - Fix \"login\" crash\n") {
+		t.Errorf("Unexpected output: %q", got)
+	}
+	if r.lines != 2 {
+		t.Errorf("Expected 2 printed lines, got %d", r.lines)
+	}
+}
+
+// queueProvider answers with the queued responses in order.
+type queueProvider struct {
+	responses []string
+	prompts   []string
+	messages  [][]aico.Message // Earlier turns of each request
+}
+
+func (p *queueProvider) Name() string { return "queue" }
+
+func (p *queueProvider) Generate(ctx context.Context, r aico.Request) (aico.Response, error) {
+	p.prompts = append(p.prompts, r.Prompt)
+	p.messages = append(p.messages, r.Messages)
+	if len(p.responses) == 0 {
+		return aico.Response{}, errors.New("no more responses")
+	}
+	text := p.responses[0]
+	p.responses = p.responses[1:]
+	return aico.Response{Text: text, Provider: p.Name()}, nil
+}
+
+func TestGeneratorComplete(t *testing.T) {
+	followUp := func(missing int, existing []string) (string, error) {
+		return fmt.Sprintf("%d more, not %s", missing, strings.Join(existing, ";")), nil
+	}
+
+	tests := []struct {
+		name         string
+		responses    []string
+		conventional bool
+		want         []string
+		wantAsked    []string
+	}{
+		{
+			name:      "surplus candidates are trimmed",
+			responses: []string{"- A\n- B\n- C\n- D"},
+			want:      []string{"A", "B", "C"},
+		},
+		{
+			name:      "missing candidates are asked for",
+			responses: []string{"- A", "- A\n- B\n- C"},
+			want:      []string{"A", "B", "C"},
+			wantAsked: []string{"2 more, not A"},
+		},
+		{
+			name:      "short list is kept when follow-ups fail",
+			responses: []string{"- A\n- B"},
+			want:      []string{"A", "B"},
+			wantAsked: []string{"1 more, not A;B"},
+		},
+		{
+			name:         "invalid conventional candidates are replaced",
+			responses:    []string{"- feat: add a\n- Change b\n- Fix: c.", "- fix: b"},
+			conventional: true,
+			want:         []string{"feat: add a", "fix: c", "fix: b"},
+			wantAsked:    []string{"1 more, not feat: add a;fix: c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &queueProvider{responses: tt.responses}
+			g := &generator{provider: p, conventional: tt.conventional}
+
+			candidates, err := g.generate(context.Background(), "initial")
+			if err != nil {
+				t.Fatal("Expected no error, got:", err)
+			}
+			candidates, err = g.complete(context.Background(), candidates, 3, followUp)
+			if err != nil {
+				t.Fatal("Expected no error, got:", err)
+			}
+
+			var got []string
+			for _, c := range candidates {
+				got = append(got, c.Message())
+			}
+			if !equalSlices(got, tt.want) {
+				t.Errorf("complete() = %v, want %v", got, tt.want)
+			}
+			if len(tt.wantAsked) > 0 && (len(p.prompts) < 2 || p.prompts[1] != tt.wantAsked[0]) {
+				t.Errorf("Unexpected follow-up prompts: %v", p.prompts)
+			}
+		})
+	}
+}
+
+func TestGeneratorRound(t *testing.T) {
+	p := &queueProvider{responses: []string{"- A", "- B\n- C", "- D\n- E"}}
+	g := &generator{provider: p}
+	followUp := func(missing int, existing []string) (string, error) {
+		return "more", nil
+	}
+
+	if _, err := g.round(context.Background(), "initial", 3, followUp); err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	candidates, err := g.round(context.Background(), "shorter", 2, followUp)
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if len(candidates) != 2 || candidates[0].Subject != "D" {
+		t.Errorf("Unexpected candidates: %v", candidates)
+	}
+
+	// The feedback is sent after the first round, with all of its candidates
+	want := []aico.Message{{Role: "user", Content: "initial"}, {Role: "assistant", Content: "- A\n- B\n- C"}}
+	if len(p.messages) != 3 || len(p.messages[1]) != 0 || !slices.Equal(p.messages[2], want) {
+		t.Errorf("Unexpected conversations: %v", p.messages)
+	}
+	if len(g.history) != 4 || g.history[3].Content != "- D\n- E" {
+		t.Errorf("Unexpected history: %v", g.history)
+	}
+}
+
+func TestFormatCandidates(t *testing.T) {
+	candidates := []aico.Candidate{{Subject: "Add search", Body: "Users asked for it."}, {Subject: "Fix crash"}}
+	if got := formatCandidates(candidates, false); got != "- Add search\n\nUsers asked for it.\n- Fix crash" {
+		t.Errorf("Unexpected lines: %q", got)
+	}
+	got := formatCandidates(candidates, true)
+	if got != "Add search\n\nUsers asked for it.\n---\nFix crash" {
+		t.Errorf("Unexpected messages: %q", got)
+	}
+	if parsed, err := parseBodyResponse(got, false); err != nil || len(parsed) != 2 || parsed[0] != candidates[0] {
+		t.Errorf("Expected the messages to parse back, got %v (%v)", parsed, err)
+	}
+}
+
 // equalSlices checks if two slices of strings are equal
 func equalSlices(a, b []string) bool {
 	if len(a) != len(b) {
@@ -119,4 +343,4 @@ func equalSlices(a, b []string) bool {
 		}
 	}
 	return true
-}
\ No newline at end of file
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/term"
+
+	aico "github.com/komapotter/go-git-aico"
+)
+
+// errQuit is returned by the picker when the user quits without choosing.
+var errQuit = errors.New("quit")
+
+const (
+	// escapeTimeout is how long the rest of an escape sequence is waited for.
+	// Over SSH the bytes of a key such as an arrow may arrive in separate
+	// reads; an escape without more input within this time is the Escape key.
+	escapeTimeout = 100 * time.Millisecond
+
+	// resizeInterval is how often a resize of the terminal is checked for
+	// while waiting for a key.
+	resizeInterval = 100 * time.Millisecond
+)
+
+// chooseCommitMessage lets the user choose one of suggestions with the
+// full-screen picker when tui is set and both stdin and stdout are terminals,
+// and with the numbered prompt of selectCommitMessage otherwise. diff is the
+// staged diff shown in the side pane of the picker.
+func chooseCommitMessage(suggestions []string, diff string, tui bool) (selection, error) {
+	if !tui || !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return selectCommitMessage(suggestions)
+	}
+	selected, err := runPicker(newPicker(suggestions, diff), os.Stdin, os.Stdout)
+	if errors.Is(err, errQuit) {
+		os.Exit(0)
+	}
+	return selected, err
+}
+
+// runPicker shows p on the alternate screen of the terminal out, in raw mode,
+// until a suggestion or an action is chosen. The terminal is restored before
+// it returns.
+func runPicker(p *picker, in, out *os.File) (selection, error) {
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return selection{}, err
+	}
+	defer term.Restore(int(in.Fd()), state)
+	fmt.Fprint(out, "\033[?1049h\033[?25l")       // Switch to the alternate screen and hide the cursor
+	defer fmt.Fprint(out, "\033[?25h\033[?1049l") // Show the cursor and switch back
+
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	defer signal.Stop(resized)
+
+	keys := &keyReader{r: bufio.NewReader(in), wait: inputWaiter(in)}
+	for {
+		width, height, err := term.GetSize(int(out.Fd()))
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = 80, 24 // Some terminals do not report their size
+		}
+		// Lines are cleared to their end, as the terminal may have been resized
+		fmt.Fprint(out, "\033[H"+strings.Join(p.render(width-1, height), "\033[K\r\n"))
+
+		k, err := keys.next(resized)
+		if err != nil {
+			return selection{}, err
+		}
+		if k == "" {
+			continue
+		}
+		if selected, done, err := p.handle(k); done || err != nil {
+			return selected, err
+		}
+	}
+}
+
+// keyReader reads the key presses of a terminal in raw mode.
+type keyReader struct {
+	r *bufio.Reader
+
+	// wait waits up to a timeout for more input and reports whether there is
+	// some. If it is nil, only the input already read is looked at.
+	wait func(timeout time.Duration) (bool, error)
+}
+
+// next waits for the next key press and reads it, see read. It returns ""
+// without reading a key when the terminal is resized meanwhile.
+func (k *keyReader) next(resized <-chan os.Signal) (string, error) {
+	for k.wait != nil && k.r.Buffered() == 0 {
+		ready, err := k.wait(resizeInterval)
+		if err != nil {
+			return "", err
+		}
+		if ready {
+			break
+		}
+		select {
+		case <-resized:
+			return "", nil
+		default:
+		}
+	}
+	return k.read()
+}
+
+// read reads a key press. Special keys are returned by name, e.g. "up",
+// "enter" or "ctrl-c", other keys as the character they type. Unknown keys
+// are returned as "".
+func (k *keyReader) read() (string, error) {
+	r := k.r
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch c {
+	case '\r':
+		return "enter", nil
+	case '\n':
+		return "ctrl-j", nil
+	case '\t':
+		return "tab", nil
+	case 0x7f, '\b':
+		return "backspace", nil
+	case 0x03:
+		return "ctrl-c", nil
+	case 0x1b:
+		// A lone escape is the Escape key, otherwise it starts a sequence such as "\033[A"
+		if r.Buffered() == 0 {
+			if k.wait == nil {
+				return "esc", nil
+			}
+			more, err := k.wait(escapeTimeout)
+			if err != nil {
+				return "", err
+			}
+			if !more {
+				return "esc", nil
+			}
+		}
+		if next, _ := r.ReadByte(); next != '[' && next != 'O' {
+			return "", nil
+		}
+		var seq strings.Builder
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			seq.WriteByte(b)
+			if b >= 0x40 && b <= 0x7e {
+				break
+			}
+		}
+		return escapeKeys[seq.String()], nil
+	}
+	if unicode.IsControl(c) {
+		return "", nil
+	}
+	return string(c), nil
+}
+
+// escapeKeys are the names of the keys sending the escape sequences, without
+// their "\033[" or "\033O" prefix.
+var escapeKeys = map[string]string{
+	"A":  "up",
+	"B":  "down",
+	"C":  "right",
+	"D":  "left",
+	"H":  "home",
+	"F":  "end",
+	"1~": "home",
+	"4~": "end",
+	"3~": "delete",
+	"5~": "pgup",
+	"6~": "pgdown",
+}
+
+// pickerMode is what the keys typed in the picker do.
+type pickerMode int
+
+const (
+	choosing pickerMode = iota // Move between the suggestions and choose one
+	editing                    // Edit the focused suggestion inline
+	feedback                   // Type feedback on the suggestions
+)
+
+// picker is the state of the full-screen picker, see runPicker. It is kept
+// apart from the terminal so that it can be driven by handle and inspected
+// with render.
+type picker struct {
+	suggestions []string
+	files       []aico.FileDiff // Staged files shown in the side pane
+	stat        string          // `git diff --stat` of files
+
+	mode     pickerMode
+	cursor   int    // Focused suggestion
+	showDiff bool   // Show the side pane
+	file     int    // File whose diff is shown in the side pane
+	scroll   int    // First shown line of the diff of file
+	height   int    // Height of the last render, for scrolling by pages
+	input    []rune // Text edited in the editing and feedback modes
+	pos      int    // Position of the cursor in input
+	status   string // Message shown above the help line until the next key
+}
+
+func newPicker(suggestions []string, diff string) *picker {
+	files := aico.ParseDiff(diff)
+	p := &picker{suggestions: suggestions, files: files}
+	if len(files) > 0 {
+		p.stat = aico.DiffStat(files)
+	}
+	return p
+}
+
+// handle processes the key k. It reports whether the user made their choice,
+// and returns errQuit if they quit.
+func (p *picker) handle(k string) (selection, bool, error) {
+	p.status = ""
+	if k == "ctrl-c" {
+		return selection{}, false, errQuit
+	}
+	switch p.mode {
+	case editing:
+		switch k {
+		case "enter":
+			message := aico.CleanupMessage(string(p.input))
+			if message == "" {
+				p.status = "The message is empty"
+				return selection{}, false, nil
+			}
+			return selection{message: message}, true, nil
+		case "esc":
+			p.mode = choosing
+		case "ctrl-j":
+			p.insert('\n')
+		default:
+			p.editKey(k)
+		}
+	case feedback:
+		switch k {
+		case "enter":
+			if text := strings.TrimSpace(string(p.input)); text != "" {
+				return selection{feedback: text}, true, nil
+			}
+		case "esc":
+			p.mode = choosing
+		default:
+			p.editKey(k)
+		}
+	default:
+		switch k {
+		case "up", "k":
+			p.cursor = max(p.cursor-1, 0)
+		case "down", "j":
+			p.cursor = min(p.cursor+1, len(p.suggestions)-1)
+		case "enter":
+			return selection{message: p.suggestions[p.cursor]}, true, nil
+		case "e":
+			p.mode = editing
+			p.input = []rune(strings.TrimSpace(p.suggestions[p.cursor]))
+			p.pos = len(p.input)
+		case "E":
+			return selection{message: p.suggestions[p.cursor], edit: true}, true, nil
+		case "r":
+			return selection{regenerate: true}, true, nil
+		case "f":
+			p.mode = feedback
+			p.input, p.pos = nil, 0
+		case "tab", "d":
+			p.showDiff = !p.showDiff
+		case "left", "h":
+			if p.showDiff && p.file > 0 {
+				p.file--
+				p.scroll = 0
+			}
+		case "right", "l":
+			if p.showDiff && p.file < len(p.files)-1 {
+				p.file++
+				p.scroll = 0
+			}
+		case "pgup":
+			p.scroll = max(p.scroll-max(p.height/2, 1), 0)
+		case "pgdown":
+			p.scroll += max(p.height/2, 1)
+		case "q", "esc":
+			return selection{}, false, errQuit
+		}
+	}
+	return selection{}, false, nil
+}
+
+// editKey applies a key that edits the input.
+func (p *picker) editKey(k string) {
+	switch k {
+	case "left":
+		p.pos = max(p.pos-1, 0)
+	case "right":
+		p.pos = min(p.pos+1, len(p.input))
+	case "home":
+		p.pos = p.lineStart(p.pos)
+	case "end":
+		p.pos = p.lineEnd(p.pos)
+	case "up", "down":
+		// Move to the same column of the previous or next line
+		start := p.lineStart(p.pos)
+		column := p.pos - start
+		if k == "up" && start > 0 {
+			prev := p.lineStart(start - 1)
+			p.pos = min(prev+column, start-1)
+		}
+		if end := p.lineEnd(p.pos); k == "down" && end < len(p.input) {
+			p.pos = min(end+1+column, p.lineEnd(end+1))
+		}
+	case "backspace":
+		if p.pos > 0 {
+			p.input = append(p.input[:p.pos-1], p.input[p.pos:]...)
+			p.pos--
+		}
+	case "delete":
+		if p.pos < len(p.input) {
+			p.input = append(p.input[:p.pos], p.input[p.pos+1:]...)
+		}
+	default:
+		if r := []rune(k); len(r) == 1 {
+			p.insert(r[0])
+		}
+	}
+}
+
+func (p *picker) insert(r rune) {
+	p.input = append(p.input[:p.pos], append([]rune{r}, p.input[p.pos:]...)...)
+	p.pos++
+}
+
+// lineStart returns the position of the start of the line of the input at pos.
+func (p *picker) lineStart(pos int) int {
+	for pos > 0 && p.input[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+// lineEnd returns the position of the end of the line of the input at pos.
+func (p *picker) lineEnd(pos int) int {
+	for pos < len(p.input) && p.input[pos] != '\n' {
+		pos++
+	}
+	return pos
+}
+
+// pickerHelp is the help line of each mode, see help.
+var pickerHelp = map[pickerMode]string{
+	choosing: "↑↓ move  enter commit  e edit  E editor  r regenerate  f feedback  tab diff",
+	editing:  "enter commit  ctrl-j new line  esc cancel",
+	feedback: "enter send feedback  esc cancel",
+}
+
+// help returns the help line.
+func (p *picker) help() string {
+	if p.mode == choosing && p.showDiff {
+		return "←→ file  PgUp/PgDn scroll  tab hide diff  ↑↓ move  enter commit  q quit"
+	}
+	return pickerHelp[p.mode]
+}
+
+// render returns the lines of the screen, each of the given display width.
+func (p *picker) render(width, height int) []string {
+	p.height = height
+	body := max(height-2, 1) // Without the status and help lines
+
+	leftWidth, rightWidth := width, 0
+	if p.showDiff {
+		leftWidth = width / 2
+		rightWidth = width - leftWidth - 1
+	}
+	left := p.suggestionLines(leftWidth, body)
+	var right []string
+	if p.showDiff {
+		right = p.diffLines(rightWidth, body)
+	}
+
+	lines := make([]string, 0, height)
+	for i := 0; i < body; i++ {
+		line := fit("", leftWidth)
+		if i < len(left) {
+			line = left[i]
+		}
+		if p.showDiff {
+			pane := fit("", rightWidth)
+			if i < len(right) {
+				pane = right[i]
+			}
+			line += "\033[2m│\033[0m" + pane
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "\033[33m"+fit(p.status, width)+"\033[0m")
+	lines = append(lines, "\033[7m"+fit(p.help(), width)+"\033[0m")
+	return lines[:min(len(lines), height)]
+}
+
+// suggestionLines returns the lines of the left pane, scrolled so that the
+// focused suggestion or the cursor is visible.
+func (p *picker) suggestionLines(width, height int) []string {
+	lines := []string{"\033[1m" + fit("? Choose a commit message", width) + "\033[0m", fit("", width)}
+	focus := 0
+	for i, suggestion := range p.suggestions {
+		if i == p.cursor {
+			focus = len(lines)
+		}
+		if i == p.cursor && p.mode == editing {
+			column := 0
+			for _, text := range strings.Split(string(p.input), "\n") {
+				n := len([]rune(text))
+				if p.pos >= column && p.pos <= column+n {
+					focus = len(lines)
+					lines = append(lines, withCursor("> ", []rune(text), p.pos-column, width))
+				} else {
+					lines = append(lines, fit("  "+text, width))
+				}
+				column += n + 1
+			}
+			continue
+		}
+
+		subject, body, hasBody := strings.Cut(strings.TrimSpace(suggestion), "\n")
+		if i == p.cursor {
+			lines = append(lines, "\033[1;36m"+fit("> "+subject, width)+"\033[0m")
+		} else {
+			lines = append(lines, fit("  "+subject, width))
+		}
+		if hasBody {
+			for _, text := range strings.Split(body, "\n") {
+				lines = append(lines, "\033[2m"+fit("    "+text, width)+"\033[0m")
+			}
+			lines = append(lines, fit("", width))
+		}
+	}
+	if p.mode == feedback {
+		lines = append(lines, fit("", width), withCursor("Feedback: ", p.input, p.pos, width))
+		focus = len(lines) - 1
+	}
+
+	top := max(focus-height+1, 0)
+	return lines[top:min(top+height, len(lines))]
+}
+
+// diffLines returns the lines of the side pane: the diff stat of the staged
+// files and the diff of the focused one.
+func (p *picker) diffLines(width, height int) []string {
+	if len(p.files) == 0 {
+		return []string{fit(" No staged changes", width)}
+	}
+	var lines []string
+	for _, text := range strings.Split(strings.TrimSuffix(p.stat, "\n"), "\n") {
+		lines = append(lines, fit(text, width))
+	}
+	f := p.files[p.file]
+	lines = append(lines, fit("", width), "\033[1m"+fit(fmt.Sprintf(" %s (%d/%d)", f.Path, p.file+1, len(p.files)), width)+"\033[0m")
+
+	diff := strings.Split(strings.TrimSuffix(f.String(), "\n"), "\n")
+	p.scroll = min(p.scroll, max(len(diff)-1, 0))
+	for _, text := range diff[p.scroll:] {
+		if len(lines) == height {
+			break
+		}
+		switch {
+		case strings.HasPrefix(text, "+") && !strings.HasPrefix(text, "+++"):
+			lines = append(lines, "\033[32m"+fit(text, width)+"\033[0m")
+		case strings.HasPrefix(text, "-") && !strings.HasPrefix(text, "---"):
+			lines = append(lines, "\033[31m"+fit(text, width)+"\033[0m")
+		case strings.HasPrefix(text, "@@"):
+			lines = append(lines, "\033[36m"+fit(text, width)+"\033[0m")
+		default:
+			lines = append(lines, fit(text, width))
+		}
+	}
+	return lines[:min(len(lines), height)]
+}
+
+// withCursor fits prefix and text into width with the cursor, shown in
+// reverse video, at position pos of text. Text before the cursor is cut off
+// when the line is too long to show it.
+func withCursor(prefix string, text []rune, pos, width int) string {
+	before, under, after := text[:pos], " ", ""
+	if pos < len(text) {
+		under, after = string(text[pos]), string(text[pos+1:])
+	}
+	for len(before) > 0 && displayWidth(prefix+string(before)+under) > width {
+		before = before[1:]
+	}
+	head := prefix + string(before)
+	rest := width - displayWidth(head) - displayWidth(under)
+	if rest < 0 {
+		return fit(head, width)
+	}
+	return head + "\033[7m" + under + "\033[27m" + fit(after, rest)
+}
+
+// fit cuts s off or pads it with spaces to the display width.
+func fit(s string, width int) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+	var b strings.Builder
+	used := 0
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			continue
+		}
+		w := runeWidth(r)
+		if used+w > width {
+			break
+		}
+		b.WriteRune(r)
+		used += w
+	}
+	b.WriteString(strings.Repeat(" ", max(width-used, 0)))
+	return b.String()
+}
+
+// displayWidth returns the number of terminal columns s takes up.
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// runeWidth returns the number of terminal columns r takes up: two for the
+// wide characters of Chinese, Japanese and Korean, one otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case r >= 0x1100 && r <= 0x115f, // Hangul Jamo
+		r >= 0x2e80 && r <= 0xa4cf, // CJK radicals to Yi, including kana and ideographs
+		r >= 0xac00 && r <= 0xd7a3, // Hangul syllables
+		r >= 0xf900 && r <= 0xfaff, // CJK compatibility ideographs
+		r >= 0xfe30 && r <= 0xfe4f, // CJK compatibility forms
+		r >= 0xff00 && r <= 0xff60, // Fullwidth forms
+		r >= 0xffe0 && r <= 0xffe6:
+		return 2
+	}
+	return 1
+}
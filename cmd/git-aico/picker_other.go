@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// inputWaiter returns nil, as waiting for input with a timeout needs select(2).
+// Escape sequences split across reads are then not waited for.
+func inputWaiter(in *os.File) func(time.Duration) (bool, error) {
+	return nil
+}
+
+// notifyResize does nothing; the picker is redrawn at the new size after the
+// next key.
+func notifyResize(c chan<- os.Signal) {}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyReader(t *testing.T) {
+	k := &keyReader{r: bufio.NewReader(strings.NewReader("a\r\033[A\033[B\033[6~\x7f\tü\n\x03"))}
+	want := []string{"a", "enter", "up", "down", "pgdown", "backspace", "tab", "ü", "ctrl-j", "ctrl-c"}
+	for _, w := range want {
+		if got, err := k.read(); err != nil || got != w {
+			t.Errorf("read() = %q, %v, want %q", got, err, w)
+		}
+	}
+	if _, err := k.read(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
+
+// chunkReader returns one chunk per read, like a terminal over a slow connection.
+type chunkReader []string
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(*c) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, (*c)[0])
+	*c = (*c)[1:]
+	return n, nil
+}
+
+func TestKeyReaderSplitSequence(t *testing.T) {
+	// The escape of an arrow key arrives before the rest of its sequence
+	chunks := &chunkReader{"\033", "[A", "\033"}
+	k := &keyReader{
+		r:    bufio.NewReader(chunks),
+		wait: func(time.Duration) (bool, error) { return len(*chunks) > 0, nil },
+	}
+	for _, w := range []string{"up", "esc"} {
+		if got, err := k.next(nil); err != nil || got != w {
+			t.Errorf("next() = %q, %v, want %q", got, err, w)
+		}
+	}
+
+	// A resize while waiting for a key is reported as ""
+	resized := make(chan os.Signal, 1)
+	resized <- os.Interrupt
+	if got, err := k.next(resized); err != nil || got != "" {
+		t.Errorf("Expected no key after a resize, got %q, %v", got, err)
+	}
+}
+
+// pickerDiff is a staged diff of two files for the picker tests.
+const pickerDiff = `diff --git a/web/search.go b/web/search.go
+--- a/web/search.go
++++ b/web/search.go
+@@ -1,2 +1,2 @@
+ package web
+-var limit = 10
++var limit = 20
+diff --git a/README.md b/README.md
+--- a/README.md
++++ b/README.md
+@@ -1 +1,2 @@
+ # Search
++Find old posts.
+`
+
+// press sends keys to p and returns the result of the last one.
+func press(p *picker, keys ...string) (selection, bool, error) {
+	var selected selection
+	var done bool
+	var err error
+	for _, k := range keys {
+		selected, done, err = p.handle(k)
+	}
+	return selected, done, err
+}
+
+func TestPicker(t *testing.T) {
+	suggestions := []string{"Raise the search limit", "Document search\n\nUsers asked for it.", "Update search"}
+
+	tests := []struct {
+		name string
+		keys []string
+		want selection
+		err  error
+	}{
+		{"enter commits the focused message", []string{"down", "j", "k", "enter"}, selection{message: suggestions[1]}, nil},
+		{"cursor stays in the list", []string{"up", "down", "down", "down", "enter"}, selection{message: suggestions[2]}, nil},
+		{"inline edit", []string{"e", "backspace", "backspace", "backspace", "2", "0", "enter"}, selection{message: "Raise the search li20"}, nil},
+		{"inline edit with a new line", []string{"e", "ctrl-j", "ctrl-j", "B", "up", "up", "home", "delete", "r", "enter"}, selection{message: "raise the search limit\n\nB"}, nil},
+		{"cancelled edit", []string{"e", "x", "esc", "down", "E"}, selection{message: suggestions[1], edit: true}, nil},
+		{"regenerate", []string{"r"}, selection{regenerate: true}, nil},
+		{"feedback", []string{"f", "enter", "s", "h", "o", "r", "t", "e", "r", "enter"}, selection{feedback: "shorter"}, nil},
+		{"quit", []string{"down", "q"}, selection{}, errQuit},
+		{"ctrl-c quits while editing", []string{"e", "ctrl-c"}, selection{}, errQuit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPicker(suggestions, pickerDiff)
+			got, done, err := press(p, tt.keys...)
+			if got != tt.want || err != tt.err || done != (tt.err == nil) {
+				t.Errorf("Got %+v (done: %v, err: %v), want %+v (err: %v)", got, done, err, tt.want, tt.err)
+			}
+		})
+	}
+
+	// An edited message that is empty is not committed
+	p := newPicker(suggestions, pickerDiff)
+	press(p, "e")
+	p.input, p.pos = []rune("# only a comment"), 16
+	if _, done, _ := p.handle("enter"); done || p.status == "" {
+		t.Errorf("Expected the empty message to be refused, got status %q", p.status)
+	}
+}
+
+func TestPickerRender(t *testing.T) {
+	p := newPicker([]string{"Raise the search limit", "Document search\n\nUsers asked for it."}, pickerDiff)
+	screen := strings.Join(p.render(80, 12), "\n")
+	if !strings.Contains(screen, "> Raise the search limit") || !strings.Contains(screen, "    Users asked for it.") || strings.Contains(screen, "web/search.go") {
+		t.Errorf("Unexpected screen without the diff pane:\n%s", screen)
+	}
+
+	press(p, "tab", "right")
+	lines := p.render(80, 20)
+	if len(lines) != 20 {
+		t.Fatalf("Expected 20 lines, got %d", len(lines))
+	}
+	screen = strings.Join(lines, "\n")
+	for _, want := range []string{" web/search.go | 2 +-", "2 files changed", "README.md (2/2)", "+Find old posts."} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("Expected %q in the diff pane:\n%s", want, screen)
+		}
+	}
+	if strings.Contains(screen, "+var limit = 20") {
+		t.Errorf("Expected only the diff of the focused file:\n%s", screen)
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"abc", 5, "abc  "},
+		{"abcdef", 4, "abcd"},
+		{"\tx", 6, "    x "},
+		{"検索を追加", 5, "検索 "},
+		{"검색 추가", 6, "검색  "},
+	}
+	for _, tt := range tests {
+		if got := fit(tt.s, tt.width); got != tt.want {
+			t.Errorf("fit(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// inputWaiter returns a function that waits up to a timeout for input on the
+// terminal in and reports whether there is some, see keyReader.
+func inputWaiter(in *os.File) func(time.Duration) (bool, error) {
+	fd := int(in.Fd())
+	return func(timeout time.Duration) (bool, error) {
+		var fds unix.FdSet
+		fds.Set(fd)
+		tv := unix.NsecToTimeval(timeout.Nanoseconds())
+		n, err := unix.Select(fd+1, &fds, nil, nil, &tv)
+		if err == unix.EINTR {
+			return false, nil // Interrupted by a signal such as SIGWINCH
+		}
+		return n > 0, err
+	}
+}
+
+// notifyResize sends to c when the terminal is resized.
+func notifyResize(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGWINCH)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// subjectPattern matches a complete "subject" field of a structured response
+// whose JSON may still be incomplete.
+var subjectPattern = regexp.MustCompile(`"subject"\s*:\s*("(?:[^"\\]|\\.)*")`)
+
+// candidateRenderer prints commit message candidates while the response is
+// streamed, one candidate as soon as its line, or for structured responses
+// its subject, is complete. The first printed candidate replaces the spinner.
+type candidateRenderer struct {
+	out         io.Writer
+	stopSpinner func()
+	body        bool // Messages have a body; only their subjects are printed
+
+	text     strings.Builder // Whole text of a structured response
+	subjects int             // Number of subjects found in text so far
+	pending  string          // Text of the line that is not complete yet
+	inBody   bool            // The subject of the current message was printed
+	lines    int             // Number of printed lines, see clear
+}
+
+// write consumes a chunk of streamed text.
+func (r *candidateRenderer) write(text string) {
+	if r.structured(text) {
+		r.text.WriteString(text)
+		matches := subjectPattern.FindAllStringSubmatch(r.text.String(), -1)
+		for _, m := range matches[r.subjects:] {
+			r.subjects++
+			var subject string
+			if err := json.Unmarshal([]byte(m[1]), &subject); err == nil {
+				r.printLine(subject)
+			}
+		}
+		return
+	}
+
+	r.pending += text
+	for {
+		i := strings.IndexByte(r.pending, '\n')
+		if i < 0 {
+			return
+		}
+		r.printTextLine(r.pending[:i])
+		r.pending = r.pending[i+1:]
+	}
+}
+
+// restart prepares for the next response, keeping the printed lines.
+func (r *candidateRenderer) restart() {
+	r.text.Reset()
+	r.subjects = 0
+	r.pending = ""
+	r.inBody = false
+}
+
+// structured reports whether the response is JSON rather than "- " lines,
+// judging by its first non-blank character.
+func (r *candidateRenderer) structured(text string) bool {
+	if r.text.Len() > 0 {
+		return true
+	}
+	return r.pending == "" && strings.HasPrefix(strings.TrimSpace(text), "{")
+}
+
+// flush prints the last line, which has no trailing newline.
+func (r *candidateRenderer) flush() {
+	r.printTextLine(r.pending)
+	r.pending = ""
+}
+
+// clear erases the printed candidates so the numbered list can take their place.
+func (r *candidateRenderer) clear() {
+	if r.lines > 0 {
+		fmt.Fprintf(r.out, "\033[%dA\r\033[J", r.lines)
+		r.lines = 0
+	}
+}
+
+// printTextLine prints a line of a plain text response. Of messages with a
+// body, only the first line after each separator is printed.
+func (r *candidateRenderer) printTextLine(line string) {
+	if !r.body {
+		r.printLine(line)
+		return
+	}
+	switch {
+	case messageSeparator.MatchString(line):
+		r.inBody = false
+	case !r.inBody && strings.TrimSpace(line) != "":
+		r.printLine(line)
+		r.inBody = true
+	}
+}
+
+func (r *candidateRenderer) printLine(line string) {
+	line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "- "))
+	if line == "" {
+		return
+	}
+	r.stopSpinner()
+	fmt.Fprintf(r.out, "\r\033[K  - %s\n", line)
+	r.lines++
+}
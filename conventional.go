@@ -0,0 +1,101 @@
+package aico
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ConventionalTypes are the commit types of the Conventional Commits
+// convention, as used by commitlint's config-conventional.
+var ConventionalTypes = []string{"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"}
+
+// conventionalTypeAliases maps types models commonly come up with to the
+// standard ones.
+var conventionalTypeAliases = map[string]string{
+	"feature":       "feat",
+	"features":      "feat",
+	"add":           "feat",
+	"bug":           "fix",
+	"bugfix":        "fix",
+	"hotfix":        "fix",
+	"doc":           "docs",
+	"documentation": "docs",
+	"refactoring":   "refactor",
+	"performance":   "perf",
+	"tests":         "test",
+	"testing":       "test",
+	"deps":          "build",
+	"dependencies":  "build",
+	"chores":        "chore",
+}
+
+// capitalisedNouns are the languages whose subjects may start with a
+// capitalised noun, e.g. "feat: Suchfunktion hinzufügen".
+var capitalisedNouns = map[string]bool{"de": true, "lb": true}
+
+// conventionalHeader matches "type(scope)!: subject" loosely, so that a
+// header with a wrongly cased type or a missing space can still be repaired.
+var conventionalHeader = regexp.MustCompile(`^\s*([A-Za-z]+)\s*(?:\(([^()]*)\))?\s*(!)?\s*:\s*(.*)$`)
+
+// RepairConventional returns c with a subject in the Conventional Commits
+// format "type(scope)!: subject". A subject that is nearly valid is repaired:
+// the type is lower-cased and aliases such as "feature" are replaced, and a
+// subject without a header gets one built from c.Type and c.Scope. The first
+// letter of the subject is lower-cased too, unless language, a BCP 47 tag,
+// capitalises nouns. The Type and Scope of the result are those of its
+// subject. An error is returned when no valid type can be found.
+func RepairConventional(c Candidate, language string) (Candidate, error) {
+	subject := strings.TrimSpace(c.Subject)
+	typ, scope, breaking := c.Type, c.Scope, ""
+	if m := conventionalHeader.FindStringSubmatch(subject); m != nil && conventionalType(m[1]) != "" {
+		typ, scope, breaking, subject = m[1], m[2], m[3], m[4]
+	}
+
+	typ = conventionalType(typ)
+	if typ == "" {
+		return c, fmt.Errorf("not a Conventional Commits message: %q", c.Subject)
+	}
+	scope = strings.TrimSpace(scope)
+	subject = strings.TrimSuffix(strings.TrimSpace(subject), ".")
+	if subject == "" {
+		return c, fmt.Errorf("empty Conventional Commits subject: %q", c.Subject)
+	}
+
+	header := typ
+	if scope != "" {
+		header += "(" + scope + ")"
+	}
+	if !capitalisedNouns[BaseLanguage(language)] {
+		subject = lowerFirst(subject)
+	}
+	c.Subject = header + breaking + ": " + subject
+	c.Type, c.Scope = typ, scope
+	return c, nil
+}
+
+// conventionalType returns the standard type for typ, or "" if there is none.
+func conventionalType(typ string) string {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	if alias, ok := conventionalTypeAliases[typ]; ok {
+		return alias
+	}
+	if slices.Contains(ConventionalTypes, typ) {
+		return typ
+	}
+	return ""
+}
+
+// lowerFirst lower-cases the first letter of s unless it starts an acronym
+// such as "API".
+func lowerFirst(s string) string {
+	first, size := utf8.DecodeRuneInString(s)
+	next, _ := utf8.DecodeRuneInString(s[size:])
+	if unicode.IsUpper(next) {
+		return s
+	}
+	return string(unicode.ToLower(first)) + s[size:]
+}
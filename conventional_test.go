@@ -0,0 +1,95 @@
+package aico
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRepairConventional(t *testing.T) {
+	tests := []struct {
+		name      string
+		candidate Candidate
+		language  string
+		expected  Candidate
+		wantErr   bool
+	}{
+		{
+			name:      "valid",
+			candidate: Candidate{Subject: "feat(api): add search endpoint"},
+			expected:  Candidate{Subject: "feat(api): add search endpoint", Type: "feat", Scope: "api"},
+		},
+		{
+			name:      "breaking change without scope",
+			candidate: Candidate{Subject: "refactor!: drop Go 1.20 support"},
+			expected:  Candidate{Subject: "refactor!: drop Go 1.20 support", Type: "refactor"},
+		},
+		{
+			name:      "cased alias, missing space and trailing period",
+			candidate: Candidate{Subject: "Feature(ui):Add dark mode."},
+			expected:  Candidate{Subject: "feat(ui): add dark mode", Type: "feat", Scope: "ui"},
+		},
+		{
+			name:      "header from the structured type and scope",
+			candidate: Candidate{Subject: "Fix crash on login", Type: "fix", Scope: "auth"},
+			expected:  Candidate{Subject: "fix(auth): fix crash on login", Type: "fix", Scope: "auth"},
+		},
+		{
+			name:      "acronym kept",
+			candidate: Candidate{Subject: "docs: README update"},
+			expected:  Candidate{Subject: "docs: README update", Type: "docs"},
+		},
+		{
+			name:      "body kept",
+			candidate: Candidate{Subject: "fix: handle nil", Body: "Details."},
+			expected:  Candidate{Subject: "fix: handle nil", Body: "Details.", Type: "fix"},
+		},
+		{
+			name:      "capitalised noun kept",
+			candidate: Candidate{Subject: "Feat: Suchfunktion hinzufügen"},
+			language:  "de-AT",
+			expected:  Candidate{Subject: "feat: Suchfunktion hinzufügen", Type: "feat"},
+		},
+		{
+			name:      "no type",
+			candidate: Candidate{Subject: "Fix crash on login"},
+			wantErr:   true,
+		},
+		{
+			name:      "unknown type",
+			candidate: Candidate{Subject: "update: bump deps"},
+			wantErr:   true,
+		},
+		{
+			name:      "empty subject",
+			candidate: Candidate{Subject: "fix(auth): "},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RepairConventional(tt.candidate, tt.language)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RepairConventional() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.expected {
+				t.Errorf("RepairConventional() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCreatePromptConventional(t *testing.T) {
+	prompt := mustCreatePrompt(t, "DIFF", PromptOptions{NumCandidates: 2, Conventional: true})
+	for _, expected := range []string{"generate 2 appropriate", `"type(scope): subject"`, "feat(home): add search", "git diff:\n---\n\nDIFF"} {
+		if !strings.Contains(prompt, expected) {
+			t.Errorf("Expected %q in the prompt:\n%s", expected, prompt)
+		}
+	}
+	prompt = mustCreatePrompt(t, "DIFF", PromptOptions{NumCandidates: 2, Conventional: true, Scope: "billing"})
+	if !strings.Contains(prompt, `suggest the scope "billing"`) {
+		t.Errorf("Expected the scope hint in the prompt:\n%s", prompt)
+	}
+	if prompt := mustCreatePrompt(t, "DIFF", PromptOptions{NumCandidates: 2, Scope: "billing"}); strings.Contains(prompt, "Conventional") || strings.Contains(prompt, "billing") {
+		t.Errorf("Expected no Conventional Commits rules by default:\n%s", prompt)
+	}
+}
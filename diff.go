@@ -0,0 +1,98 @@
+package aico
+
+import (
+	"strings"
+)
+
+// FileDiff is the part of a unified git diff that concerns a single file.
+type FileDiff struct {
+	Path   string
+	Header []string // From the "diff --git" line up to the "+++" line
+	Hunks  []Hunk
+}
+
+// Hunk is a single "@@" section of a FileDiff.
+type Hunk struct {
+	Header string   // The "@@ -a,b +c,d @@" line
+	Lines  []string // Context, added and removed lines
+}
+
+// ParseDiff splits the output of `git diff` into files and hunks.
+func ParseDiff(diff string) []FileDiff {
+	var files []FileDiff
+	var file *FileDiff
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			files = append(files, FileDiff{Path: diffGitPath(line), Header: []string{line}})
+			file = &files[len(files)-1]
+		case file == nil:
+			// Not a git diff, e.g. empty output
+		case strings.HasPrefix(line, "@@"):
+			file.Hunks = append(file.Hunks, Hunk{Header: line})
+		case len(file.Hunks) > 0:
+			h := &file.Hunks[len(file.Hunks)-1]
+			h.Lines = append(h.Lines, line)
+		default:
+			file.Header = append(file.Header, line)
+			if path, ok := strings.CutPrefix(line, "+++ b/"); ok {
+				file.Path = path
+			}
+		}
+	}
+	return files
+}
+
+// diffGitPath returns the new path of a "diff --git a/old b/new" line.
+func diffGitPath(line string) string {
+	paths := strings.TrimPrefix(line, "diff --git ")
+	if i := strings.LastIndex(paths, " b/"); i >= 0 {
+		return strings.Trim(paths[i+3:], `"`)
+	}
+	return paths
+}
+
+// Stat returns the number of added and deleted lines.
+func (f FileDiff) Stat() (added, deleted int) {
+	for _, h := range f.Hunks {
+		a, d := h.Stat()
+		added += a
+		deleted += d
+	}
+	return added, deleted
+}
+
+// String returns the file's part of the diff.
+func (f FileDiff) String() string {
+	var b strings.Builder
+	for _, line := range f.Header {
+		b.WriteString(line + "\n")
+	}
+	for _, h := range f.Hunks {
+		b.WriteString(h.String())
+	}
+	return b.String()
+}
+
+// Stat returns the number of added and deleted lines.
+func (h Hunk) Stat() (added, deleted int) {
+	for _, line := range h.Lines {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			deleted++
+		}
+	}
+	return added, deleted
+}
+
+// String returns the hunk's part of the diff.
+func (h Hunk) String() string {
+	var b strings.Builder
+	b.WriteString(h.Header + "\n")
+	for _, line := range h.Lines {
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
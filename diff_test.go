@@ -0,0 +1,99 @@
+package aico
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testDiff = `diff --git a/main.go b/main.go
+index 83db48f..bf269f4 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@ package main
+ import "fmt"
++import "os"
+ 
+-func main() {}
+@@ -10,2 +11,2 @@ func run() {
+-	return nil
++	return os.ErrNotExist
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+index 83db48f..0000000
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+
+func TestParseDiff(t *testing.T) {
+	files := ParseDiff(testDiff)
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(files))
+	}
+	if files[0].Path != "main.go" || files[1].Path != "old.txt" {
+		t.Errorf("Unexpected paths: %q, %q", files[0].Path, files[1].Path)
+	}
+	if len(files[0].Hunks) != 2 || len(files[0].Header) != 4 {
+		t.Errorf("Unexpected main.go diff: %+v", files[0])
+	}
+	if added, deleted := files[0].Stat(); added != 2 || deleted != 2 {
+		t.Errorf("Unexpected stat: +%d -%d", added, deleted)
+	}
+
+	var rebuilt string
+	for _, f := range files {
+		rebuilt += f.String()
+	}
+	if rebuilt != testDiff {
+		t.Errorf("Expected String() to reproduce the diff, got:\n%s", rebuilt)
+	}
+}
+
+func TestTruncateDiff(t *testing.T) {
+	estimate := func(text string) int { return EstimateTokens("gpt-4o", text) }
+
+	// A diff that fits is returned unchanged
+	if got := TruncateDiff(testDiff, 10000, estimate); got.Truncated() || got.Diff != testDiff {
+		t.Errorf("Expected the diff to be unchanged, got %+v", got)
+	}
+
+	// One small informative hunk and a huge file of generated data
+	var b strings.Builder
+	b.WriteString("diff --git a/fix.go b/fix.go\n--- a/fix.go\n+++ b/fix.go\n@@ -1,1 +1,1 @@\n-\treturn a\n+\treturn b\n")
+	b.WriteString("diff --git a/data.json b/data.json\n--- a/data.json\n+++ b/data.json\n@@ -1,0 +1,2000 @@\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&b, "+{\"id\": %d, \"value\": \"lorem ipsum dolor sit amet\"},\n", i)
+	}
+	diff := b.String()
+
+	got := TruncateDiff(diff, 300, estimate)
+	if !got.Truncated() || got.Tokens > 300 {
+		t.Fatalf("Expected the diff to be truncated to 300 tokens, got %+v", got)
+	}
+	if !strings.Contains(got.Diff, "+\treturn b") {
+		t.Error("Expected the informative hunk to be kept")
+	}
+	if got.ElidedFiles != 1 || !strings.Contains(got.Diff, "data.json | 2000 ++++") {
+		t.Errorf("Expected data.json to be summarised as a stat line, got:\n%s", got.Diff)
+	}
+	if got.ElidedTokens <= 0 {
+		t.Errorf("Expected elided tokens to be reported, got %d", got.ElidedTokens)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if got := EstimateTokens("gpt-4o", strings.Repeat("a", 400)); got != 100 {
+		t.Errorf("Expected 100 tokens, got %d", got)
+	}
+	if got := EstimateTokens("gpt-4o", "日本語"); got != 3 {
+		t.Errorf("Expected 3 tokens, got %d", got)
+	}
+	if got := ContextWindow("library/llama3.1:8b"); got != 131072 {
+		t.Errorf("Unexpected context window: %d", got)
+	}
+	if got := ContextWindow("my-finetune"); got != defaultContextWindow {
+		t.Errorf("Expected the default context window, got %d", got)
+	}
+}
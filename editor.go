@@ -0,0 +1,89 @@
+package aico
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// editMessageHelp is appended to the message opened in the editor.
+const editMessageHelp = `
+# Edit the commit message. Lines starting with '#' are ignored,
+# and an empty message aborts the commit.
+`
+
+// Editor returns the command of the editor for commit messages, chosen the
+// way git does: GIT_EDITOR, the core.editor setting of repo, VISUAL unless the
+// terminal is dumb, EDITOR and finally vi.
+func Editor(repo Repository) (string, error) {
+	if editor := os.Getenv("GIT_EDITOR"); editor != "" {
+		return editor, nil
+	}
+	editor, err := repo.Config("core.editor")
+	if err != nil {
+		return "", fmt.Errorf("reading core.editor: %w", err)
+	}
+	if editor != "" {
+		return editor, nil
+	}
+	if editor := os.Getenv("VISUAL"); editor != "" && os.Getenv("TERM") != "dumb" {
+		return editor, nil
+	}
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		return editor, nil
+	}
+	return "vi", nil
+}
+
+// EditMessage opens message in editor, like `git commit -e`, and returns the
+// edited message after CleanupMessage. The editor is run by the shell, so it
+// may include arguments such as "code --wait". An empty result means the
+// commit should be aborted.
+func EditMessage(editor, message string) (string, error) {
+	dir, err := os.MkdirTemp("", "git-aico-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	// Editors recognise the name and highlight the message as a commit message
+	path := filepath.Join(dir, "COMMIT_EDITMSG")
+	if err := os.WriteFile(path, []byte(strings.TrimSpace(message)+"\n"+editMessageHelp), 0o600); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running the editor %q: %w", editor, err)
+	}
+
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return CleanupMessage(string(edited)), nil
+}
+
+// blankLines matches the blank lines between paragraphs.
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// CleanupMessage removes the lines starting with '#', trailing whitespace and
+// surplus blank lines from an edited commit message, like git's default
+// "strip" cleanup mode.
+func CleanupMessage(message string) string {
+	var lines []string
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+	message = strings.Trim(strings.Join(lines, "\n"), "\n")
+	return blankLines.ReplaceAllString(message, "\n\n")
+}
@@ -0,0 +1,84 @@
+package aico
+
+import (
+	"testing"
+)
+
+// configRepository is a Repository with a fixed configuration.
+type configRepository struct {
+	Repository
+	config map[string]string
+}
+
+func (r configRepository) Config(key string) (string, error) {
+	return r.config[key], nil
+}
+
+func TestEditor(t *testing.T) {
+	t.Setenv("GIT_EDITOR", "")
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	t.Setenv("TERM", "xterm")
+	repo := configRepository{config: map[string]string{}}
+
+	for _, tt := range []struct {
+		env, value, want string
+	}{
+		{"", "", "vi"},
+		{"EDITOR", "nano", "nano"},
+		{"VISUAL", "code --wait", "code --wait"},
+		{"core.editor", "emacs", "emacs"},
+		{"GIT_EDITOR", "vim", "vim"},
+	} {
+		if tt.env == "core.editor" {
+			repo.config[tt.env] = tt.value
+		} else if tt.env != "" {
+			t.Setenv(tt.env, tt.value)
+		}
+		if got, err := Editor(repo); err != nil || got != tt.want {
+			t.Errorf("Editor() with %s=%s = %q, %v, want %q", tt.env, tt.value, got, err, tt.want)
+		}
+	}
+
+	// VISUAL is skipped on dumb terminals
+	t.Setenv("GIT_EDITOR", "")
+	delete(repo.config, "core.editor")
+	t.Setenv("TERM", "dumb")
+	if got, _ := Editor(repo); got != "nano" {
+		t.Errorf("Expected EDITOR on a dumb terminal, got %q", got)
+	}
+}
+
+func TestEditMessage(t *testing.T) {
+	got, err := EditMessage("sed -i -e 's/search/search box/'", "Add search\n\n- web: add search")
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if got != "Add search box\n\n- web: add search box" {
+		t.Errorf("EditMessage() = %q", got)
+	}
+
+	if got, err := EditMessage("sed -i -e '/^[^#]/d'", "Add search"); err != nil || got != "" {
+		t.Errorf("Expected an empty message, got %q, %v", got, err)
+	}
+	if _, err := EditMessage("false", "Add search"); err == nil {
+		t.Error("Expected an error when the editor fails")
+	}
+}
+
+func TestCleanupMessage(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{"Add search\n", "Add search"},
+		{"\n\nAdd search  \n\n\n\nBody\t\n\n# Comment\n", "Add search\n\nBody"},
+		{"# Only comments\n#\n", ""},
+		{"Add search\n# Comment\nBody", "Add search\nBody"},
+	}
+	for _, tt := range tests {
+		if got := CleanupMessage(tt.message); got != tt.expected {
+			t.Errorf("CleanupMessage(%q) = %q, want %q", tt.message, got, tt.expected)
+		}
+	}
+}
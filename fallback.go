@@ -0,0 +1,101 @@
+package aico
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Fallback returns a provider that tries providers in order and returns the
+// first successful response. A provider is skipped when it fails for any
+// reason other than cancellation of the context, so retries should be applied
+// to the individual providers with WithRetry beforehand.
+func Fallback(providers ...Provider) Provider {
+	if len(providers) == 1 {
+		return providers[0]
+	}
+	return &fallbackProvider{providers: providers}
+}
+
+type fallbackProvider struct {
+	providers []Provider
+}
+
+// Name implements Provider.
+func (p *fallbackProvider) Name() string {
+	names := make([]string, len(p.providers))
+	for i, provider := range p.providers {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// MaxPromptTokens implements TokenLimits. The prompt has to fit every
+// provider that may be fallen back to.
+func (p *fallbackProvider) MaxPromptTokens() int {
+	limit := 0
+	for i, provider := range p.providers {
+		if l := LimitsOf(provider).MaxPromptTokens(); i == 0 || l < limit {
+			limit = l
+		}
+	}
+	return limit
+}
+
+// EstimateTokens implements TokenLimits, with the highest estimate of all providers.
+func (p *fallbackProvider) EstimateTokens(text string) int {
+	tokens := 0
+	for _, provider := range p.providers {
+		tokens = max(tokens, LimitsOf(provider).EstimateTokens(text))
+	}
+	return tokens
+}
+
+// Generate implements Provider.
+func (p *fallbackProvider) Generate(ctx context.Context, r Request) (Response, error) {
+	return p.do(ctx, r, func(provider Provider) (Response, bool, error) {
+		resp, err := provider.Generate(ctx, r)
+		return resp, true, err
+	})
+}
+
+// GenerateStream implements StreamingProvider. Providers that do not support
+// streaming deliver their whole response at once. Once a provider has
+// delivered text, its failure is returned instead of falling back.
+func (p *fallbackProvider) GenerateStream(ctx context.Context, r Request, onText func(string)) (Response, error) {
+	return p.do(ctx, r, func(provider Provider) (Response, bool, error) {
+		sp, ok := provider.(StreamingProvider)
+		if !ok {
+			resp, err := provider.Generate(ctx, r)
+			if err == nil {
+				onText(resp.Text)
+			}
+			return resp, true, err
+		}
+		received := false
+		resp, err := sp.GenerateStream(ctx, r, func(text string) {
+			received = true
+			onText(text)
+		})
+		return resp, !received, err
+	})
+}
+
+func (p *fallbackProvider) do(ctx context.Context, r Request, attempt func(Provider) (Response, bool, error)) (Response, error) {
+	var errs []error
+	for i, provider := range p.providers {
+		resp, canFallBack, err := attempt(provider)
+		if err == nil {
+			return resp, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+		if !canFallBack || ctx.Err() != nil {
+			break
+		}
+		if r.Verbose && i+1 < len(p.providers) {
+			fmt.Printf("\n%s failed, falling back to %s: %v\n", provider.Name(), p.providers[i+1].Name(), err)
+		}
+	}
+	return Response{}, errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package aico
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type failingProvider struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (p *failingProvider) Name() string { return p.name }
+
+func (p *failingProvider) Generate(ctx context.Context, r Request) (Response, error) {
+	p.calls++
+	return Response{}, p.err
+}
+
+func TestFallback(t *testing.T) {
+	first := &failingProvider{name: "first", err: &APIError{Provider: "first", StatusCode: 429, Status: "429 Too Many Requests"}}
+	second := &fakeProvider{text: "test response"}
+
+	p := Fallback(first, second)
+	if p.Name() != "first,fake" {
+		t.Errorf("Unexpected name: %s", p.Name())
+	}
+
+	resp, err := p.Generate(context.Background(), Request{Prompt: "test question"})
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if resp.Provider != "fake" || resp.Text != "test response" {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+	if first.calls != 1 {
+		t.Errorf("Expected the first provider to be called once, got %d", first.calls)
+	}
+
+	// Streaming falls back to providers that do not stream
+	var streamed string
+	resp, err = p.(StreamingProvider).GenerateStream(context.Background(), Request{Prompt: "test question"}, func(text string) {
+		streamed += text
+	})
+	if err != nil || resp.Provider != "fake" || streamed != "test response" {
+		t.Errorf("Unexpected streamed response: %+v, %q, %v", resp, streamed, err)
+	}
+}
+
+func TestFallbackAllFail(t *testing.T) {
+	first := &failingProvider{name: "first", err: &APIError{Provider: "first", StatusCode: 401, Status: "401 Unauthorized"}}
+	second := &failingProvider{name: "second", err: errors.New("connection refused")}
+
+	_, err := Fallback(first, second).Generate(context.Background(), Request{Prompt: "test question"})
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+	if !errors.Is(err, ErrAuth) {
+		t.Errorf("Expected the joined error to keep ErrAuth, got: %v", err)
+	}
+	if second.calls != 1 {
+		t.Errorf("Expected the second provider to be called once, got %d", second.calls)
+	}
+}
+
+func TestFallbackCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	first := &failingProvider{name: "first", err: context.Canceled}
+	second := &failingProvider{name: "second", err: errors.New("unreachable")}
+
+	_, err := Fallback(first, second).Generate(ctx, Request{Prompt: "test question"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+	if second.calls != 0 {
+		t.Error("Expected no fallback after cancellation")
+	}
+}
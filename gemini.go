@@ -0,0 +1,207 @@
+package aico
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+const geminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+type GeminiRequest struct {
+	Contents         []GeminiContent        `json:"contents"`
+	GenerationConfig GeminiGenerationConfig `json:"generationConfig"`
+}
+
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+type GeminiPart struct {
+	Text string `json:"text"`
+}
+
+type GeminiGenerationConfig struct {
+	Temperature     float64 `json:"temperature"`
+	MaxOutputTokens int     `json:"maxOutputTokens,omitempty"`
+}
+
+type GeminiResponse struct {
+	Candidates []struct {
+		Content      GeminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+}
+
+// GeminiBlockedError is returned when Gemini refuses to answer because of
+// its safety filters, either on the prompt or on the generated candidate.
+type GeminiBlockedError struct {
+	Reason string // e.g. "SAFETY", "RECITATION" or "PROHIBITED_CONTENT"
+	Prompt bool   // The prompt itself was blocked, rather than the response
+}
+
+func (e *GeminiBlockedError) Error() string {
+	if e.Prompt {
+		return fmt.Sprintf("Gemini blocked the prompt: %s", e.Reason)
+	}
+	return fmt.Sprintf("Gemini blocked the response: finish reason %s", e.Reason)
+}
+
+// geminiBlockedFinishReasons are the finish reasons that mean the candidate
+// was withheld rather than completed.
+var geminiBlockedFinishReasons = map[string]bool{
+	"SAFETY":             true,
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+}
+
+// GeminiConfig is the environment configuration of the "gemini" provider.
+type GeminiConfig struct {
+	Key         string  `envconfig:"GEMINI_API_KEY"`
+	Model       string  `envconfig:"GEMINI_MODEL" default:"gemini-1.5-flash"`
+	Temperature float64 `envconfig:"GEMINI_TEMPERATURE" default:"0.1"`
+	MaxTokens   int     `envconfig:"GEMINI_MAX_TOKENS" default:"450"`
+}
+
+// GeminiProvider generates completions with the Gemini generateContent API.
+type GeminiProvider struct {
+	BaseURL     string
+	Key         string
+	Model       string
+	Temperature float64
+	MaxTokens   int
+}
+
+func init() {
+	RegisterProvider("gemini", newGeminiProviderFromEnv)
+}
+
+func newGeminiProviderFromEnv() (Provider, error) {
+	var cfg GeminiConfig
+	if err := envconfig.Process("", &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Key == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY is required when MODEL_PROVIDER=gemini")
+	}
+	return &GeminiProvider{
+		BaseURL:     geminiBaseURL,
+		Key:         cfg.Key,
+		Model:       cfg.Model,
+		Temperature: cfg.Temperature,
+		MaxTokens:   cfg.MaxTokens,
+	}, nil
+}
+
+// Name implements Provider.
+func (p *GeminiProvider) Name() string { return "gemini" }
+
+// geminiContents returns the conversation of r as contents, in which the
+// answers of the model have the role "model".
+func geminiContents(r Request) []GeminiContent {
+	var contents []GeminiContent
+	for _, m := range r.conversation() {
+		role := m.Role
+		if role == "assistant" {
+			role = "model"
+		}
+		contents = append(contents, GeminiContent{Role: role, Parts: []GeminiPart{{Text: m.Content}}})
+	}
+	return contents
+}
+
+// generateURL returns the generateContent endpoint of the model.
+func (p *GeminiProvider) generateURL() string {
+	return fmt.Sprintf("%s/models/%s:generateContent", strings.TrimRight(p.BaseURL, "/"), url.PathEscape(p.Model))
+}
+
+// MaxPromptTokens implements TokenLimits.
+func (p *GeminiProvider) MaxPromptTokens() int {
+	return modelTokenLimits{p.Model, p.MaxTokens}.MaxPromptTokens()
+}
+
+// EstimateTokens implements TokenLimits.
+func (p *GeminiProvider) EstimateTokens(text string) int {
+	return EstimateTokens(p.Model, text)
+}
+
+// Generate implements Provider.
+func (p *GeminiProvider) Generate(ctx context.Context, r Request) (Response, error) {
+	data := GeminiRequest{
+		Contents: geminiContents(r),
+		GenerationConfig: GeminiGenerationConfig{
+			Temperature:     p.Temperature,
+			MaxOutputTokens: p.MaxTokens,
+		},
+	}
+	payloadBytes, err := json.Marshal(data)
+	if err != nil {
+		return Response{}, err
+	}
+	body := bytes.NewReader(payloadBytes)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.generateURL(), body)
+	if err != nil {
+		return Response{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Goog-Api-Key", p.Key)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, newAPIError("Gemini", resp, respBody)
+	}
+
+	if r.Verbose {
+		fmt.Printf("\nRaw response from Gemini: %v", string(respBody))
+	}
+
+	var apiResp GeminiResponse
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return Response{}, err
+	}
+
+	if reason := apiResp.PromptFeedback.BlockReason; reason != "" {
+		return Response{}, &GeminiBlockedError{Reason: reason, Prompt: true}
+	}
+	if len(apiResp.Candidates) == 0 {
+		return Response{}, fmt.Errorf("no response from Gemini")
+	}
+
+	candidate := apiResp.Candidates[0]
+	if geminiBlockedFinishReasons[candidate.FinishReason] {
+		return Response{}, &GeminiBlockedError{Reason: candidate.FinishReason}
+	}
+
+	var text strings.Builder
+	for _, part := range candidate.Content.Parts {
+		text.WriteString(part.Text)
+	}
+	if text.Len() == 0 {
+		return Response{}, fmt.Errorf("no response from Gemini")
+	}
+	return Response{Text: strings.TrimSpace(text.String()), Provider: p.Name()}, nil
+}
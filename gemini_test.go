@@ -0,0 +1,104 @@
+package aico
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGeminiProvider(t *testing.T) {
+	// Create a mock server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-test-model:generateContent" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if r.Header.Get("X-Goog-Api-Key") != "test-key" {
+			t.Error("X-Goog-Api-Key header not set correctly")
+		}
+
+		var reqBody GeminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Error("Failed to parse request body:", err)
+		}
+		if len(reqBody.Contents) != 1 || reqBody.Contents[0].Role != "user" ||
+			len(reqBody.Contents[0].Parts) != 1 || reqBody.Contents[0].Parts[0].Text != "test question" {
+			t.Errorf("Unexpected contents field: %v", reqBody.Contents)
+		}
+		if reqBody.GenerationConfig.MaxOutputTokens != 300 {
+			t.Errorf("Expected maxOutputTokens to be 300, got %d", reqBody.GenerationConfig.MaxOutputTokens)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates": [{"content": {"role": "model", "parts": [{"text": "test "}, {"text": "response"}]}, "finishReason": "STOP"}]}`))
+	}))
+	defer server.Close()
+
+	p := &GeminiProvider{BaseURL: server.URL, Key: "test-key", Model: "gemini-test-model", Temperature: 0.2, MaxTokens: 300}
+	resp, err := p.Generate(context.Background(), Request{Prompt: "test question"})
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if resp.Text != "test response" {
+		t.Errorf("Expected response to be 'test response', got: %s", resp.Text)
+	}
+}
+
+func TestGeminiContents(t *testing.T) {
+	r := Request{
+		Prompt:   "shorter",
+		Messages: []Message{{Role: "user", Content: "test question"}, {Role: "assistant", Content: "test response"}},
+	}
+	contents := geminiContents(r)
+	var roles []string
+	for _, c := range contents {
+		roles = append(roles, c.Role)
+	}
+	if strings.Join(roles, ",") != "user,model,user" || contents[2].Parts[0].Text != "shorter" {
+		t.Errorf("Unexpected contents: %v", contents)
+	}
+}
+
+func TestGeminiProviderBlocked(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		wantReason string
+		wantPrompt bool
+	}{
+		{
+			name:       "blocked prompt",
+			response:   `{"promptFeedback": {"blockReason": "SAFETY"}}`,
+			wantReason: "SAFETY",
+			wantPrompt: true,
+		},
+		{
+			name:       "blocked candidate",
+			response:   `{"candidates": [{"content": {"parts": []}, "finishReason": "RECITATION"}]}`,
+			wantReason: "RECITATION",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			p := &GeminiProvider{BaseURL: server.URL, Key: "test-key", Model: "gemini-test-model"}
+			_, err := p.Generate(context.Background(), Request{Prompt: "test question"})
+
+			var blocked *GeminiBlockedError
+			if !errors.As(err, &blocked) {
+				t.Fatalf("Expected a GeminiBlockedError, got: %v", err)
+			}
+			if blocked.Reason != tt.wantReason || blocked.Prompt != tt.wantPrompt {
+				t.Errorf("Unexpected error: %+v", blocked)
+			}
+		})
+	}
+}
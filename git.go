@@ -2,26 +2,121 @@ package aico
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 )
 
-// ExecuteGitDiff runs the `git diff` command and returns its output.
-func ExecuteGitDiffStaged() (string, error) {
-	cmd := exec.Command("git", "diff", "--staged")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+// ExecRepository is a Repository backed by the git command on PATH.
+type ExecRepository struct {
+	Dir string // Directory the commands run in, the current directory if empty
+}
+
+// StagedDiff implements Repository.
+func (r ExecRepository) StagedDiff() (string, error) {
+	return r.output("diff", "--staged")
+}
+
+// StagedFiles implements Repository.
+func (r ExecRepository) StagedFiles() ([]string, error) {
+	out, err := r.output("diff", "--staged", "--name-only", "-z")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, path := range strings.Split(out, "\x00") {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// Commit implements Repository. The output of git, including that of its
+// hooks, goes to the standard output and error.
+func (r ExecRepository) Commit(message string) error {
+	cmd := exec.Command("git", "commit", "-m", message)
+	cmd.Dir = r.Dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Log implements Repository.
+func (r ExecRepository) Log(n int) ([]string, error) {
+	if _, err := r.output("rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return nil, nil // No commits yet
+	}
+	out, err := r.output("log", "-n", strconv.Itoa(n), "--format=%B%x00")
+	if err != nil {
+		return nil, err
+	}
+	var messages []string
+	for _, message := range strings.Split(out, "\x00") {
+		if message = strings.TrimSpace(message); message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// CurrentBranch implements Repository.
+func (r ExecRepository) CurrentBranch() (string, error) {
+	branch, err := r.output("symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		return "HEAD", nil // Detached
+	}
+	return strings.TrimSpace(branch), nil
+}
+
+// Root implements Repository.
+func (r ExecRepository) Root() (string, error) {
+	root, err := r.output("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(root), nil
+}
+
+// Config implements Repository.
+func (r ExecRepository) Config(key string) (string, error) {
+	value, err := r.output("config", "--get", key)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return "", nil // Not set
+	}
 	if err != nil {
 		return "", err
 	}
+	return strings.TrimSpace(value), nil
+}
+
+// output runs git with args and returns its standard output. The standard
+// error is part of the returned error.
+func (r ExecRepository) output(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.Dir
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
 	return out.String(), nil
 }
 
+// ExecuteGitDiff runs the `git diff` command and returns its output.
+func ExecuteGitDiffStaged() (string, error) {
+	return ExecRepository{}.StagedDiff()
+}
+
 // CommitChanges runs the `git commit` command with the selected commit message.
 func CommitChanges(commitMessage string) error {
-	cmd := exec.Command("git", "commit", "-m", commitMessage)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return ExecRepository{}.Commit(commitMessage)
 }
@@ -0,0 +1,346 @@
+package aico
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// GoGitRepository is a Repository implemented in pure Go with go-git, which
+// works without a git binary and with in-memory repositories. Unlike the git
+// command it does not detect renames, run hooks or sign commits.
+type GoGitRepository struct {
+	Repo *git.Repository
+
+	// Author of the commits; if nil, user.name and user.email are read from
+	// the git configuration
+	Author *object.Signature
+}
+
+// OpenGoGitRepository opens the repository containing the directory path.
+func OpenGoGitRepository(path string) (*GoGitRepository, error) {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, err
+	}
+	return &GoGitRepository{Repo: repo}, nil
+}
+
+// StagedDiff implements Repository.
+func (r *GoGitRepository) StagedDiff() (string, error) {
+	changes, err := r.stagedChanges()
+	if err != nil {
+		return "", err
+	}
+
+	patch := gitPatch{}
+	for _, fp := range changes {
+		var src, dst []byte
+		if fp.from != nil {
+			if src, err = r.content(*fp.from); err != nil {
+				return "", err
+			}
+		}
+		if fp.to != nil {
+			if dst, err = r.content(*fp.to); err != nil {
+				return "", err
+			}
+		}
+		fp.binary = isBinary(src) || isBinary(dst)
+		if !fp.binary {
+			fp.chunks = diffChunks(string(src), string(dst))
+		}
+		patch = append(patch, fp)
+	}
+
+	var b bytes.Buffer
+	if err := fdiff.NewUnifiedEncoder(&b, fdiff.DefaultContextLines).Encode(patch); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// StagedFiles implements Repository.
+func (r *GoGitRepository) StagedFiles() ([]string, error) {
+	changes, err := r.stagedChanges()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, len(changes))
+	for i, fp := range changes {
+		if fp.to != nil {
+			files[i] = fp.to.path
+		} else {
+			files[i] = fp.from.path
+		}
+	}
+	return files, nil
+}
+
+// stagedChanges compares the index with the tree of HEAD and returns the
+// files that differ, sorted by path and without their content.
+func (r *GoGitRepository) stagedChanges() ([]*gitFilePatch, error) {
+	head, err := r.headFiles()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := r.Repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	staged := make(map[string]gitFile, len(idx.Entries))
+	for _, e := range idx.Entries {
+		staged[e.Name] = gitFile{path: e.Name, hash: e.Hash, mode: e.Mode}
+	}
+
+	paths := make([]string, 0, len(head)+len(staged))
+	for path := range head {
+		paths = append(paths, path)
+	}
+	for path := range staged {
+		if _, ok := head[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var changes []*gitFilePatch
+	for _, path := range paths {
+		from, inHead := head[path]
+		to, inIndex := staged[path]
+		if inHead && inIndex && from == to {
+			continue
+		}
+		fp := &gitFilePatch{}
+		if inHead {
+			fp.from = &from
+		}
+		if inIndex {
+			fp.to = &to
+		}
+		changes = append(changes, fp)
+	}
+	return changes, nil
+}
+
+// headFiles returns the files of the tree of HEAD, none before the first commit.
+func (r *GoGitRepository) headFiles() (map[string]gitFile, error) {
+	files := map[string]gitFile{}
+	ref, err := r.Repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	commit, err := r.Repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		path, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Mode != filemode.Dir {
+			files[path] = gitFile{path: path, hash: entry.Hash, mode: entry.Mode}
+		}
+	}
+	return files, nil
+}
+
+// content returns the content of a file as git diff shows it.
+func (r *GoGitRepository) content(f gitFile) ([]byte, error) {
+	if f.mode == filemode.Submodule {
+		return []byte("Subproject commit " + f.hash.String() + "\n"), nil
+	}
+	blob, err := r.Repo.BlobObject(f.hash)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", f.path, err)
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// Commit implements Repository.
+func (r *GoGitRepository) Commit(message string) error {
+	wt, err := r.Repo.Worktree()
+	if err != nil {
+		return err
+	}
+	_, err = wt.Commit(message, &git.CommitOptions{Author: r.Author})
+	return err
+}
+
+// Log implements Repository.
+func (r *GoGitRepository) Log(n int) ([]string, error) {
+	ref, err := r.Repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, nil // No commits yet
+	}
+	if err != nil {
+		return nil, err
+	}
+	iter, err := r.Repo.Log(&git.LogOptions{From: ref.Hash()})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var messages []string
+	for len(messages) < n {
+		commit, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, strings.TrimSpace(commit.Message))
+	}
+	return messages, nil
+}
+
+// CurrentBranch implements Repository.
+func (r *GoGitRepository) CurrentBranch() (string, error) {
+	// Read HEAD itself rather than resolving it, which fails before the first commit
+	ref, err := r.Repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+	if ref.Type() == plumbing.SymbolicReference && ref.Target().IsBranch() {
+		return ref.Target().Short(), nil
+	}
+	return "HEAD", nil
+}
+
+// Root implements Repository.
+func (r *GoGitRepository) Root() (string, error) {
+	wt, err := r.Repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+	return wt.Filesystem.Root(), nil
+}
+
+// Config implements Repository. The system, global and repository
+// configuration files are read, the latter taking precedence.
+func (r *GoGitRepository) Config(key string) (string, error) {
+	cfg, err := r.Repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return "", err
+	}
+	section, rest, ok := strings.Cut(key, ".")
+	if !ok {
+		return "", fmt.Errorf("invalid config key: %s", key)
+	}
+	subsection, name := "", rest
+	if i := strings.LastIndex(rest, "."); i >= 0 {
+		subsection, name = rest[:i], rest[i+1:]
+	}
+	s := cfg.Raw.Section(section)
+	if subsection != "" {
+		return s.Subsection(subsection).Option(name), nil
+	}
+	return s.Option(name), nil
+}
+
+// isBinary reports whether content looks binary, the way git decides it:
+// by a NUL byte in its first 8000 bytes.
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+// diffChunks computes the line-based changes from src to dst.
+func diffChunks(src, dst string) []fdiff.Chunk {
+	var chunks []fdiff.Chunk
+	for _, d := range diff.Do(src, dst) {
+		op := fdiff.Equal
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = fdiff.Add
+		case diffmatchpatch.DiffDelete:
+			op = fdiff.Delete
+		}
+		chunks = append(chunks, gitChunk{content: d.Text, op: op})
+	}
+	return chunks
+}
+
+// gitPatch implements the go-git diff.Patch interface for the staged changes.
+type gitPatch []*gitFilePatch
+
+func (p gitPatch) FilePatches() []fdiff.FilePatch {
+	patches := make([]fdiff.FilePatch, len(p))
+	for i, fp := range p {
+		patches[i] = fp
+	}
+	return patches
+}
+
+func (p gitPatch) Message() string { return "" }
+
+type gitFilePatch struct {
+	from, to *gitFile
+	binary   bool
+	chunks   []fdiff.Chunk
+}
+
+func (p *gitFilePatch) IsBinary() bool { return p.binary }
+
+func (p *gitFilePatch) Files() (from, to fdiff.File) {
+	// Leave the interfaces nil, not holding a nil pointer, for added and deleted files
+	if p.from != nil {
+		from = p.from
+	}
+	if p.to != nil {
+		to = p.to
+	}
+	return from, to
+}
+
+func (p *gitFilePatch) Chunks() []fdiff.Chunk { return p.chunks }
+
+type gitFile struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+func (f *gitFile) Hash() plumbing.Hash     { return f.hash }
+func (f *gitFile) Mode() filemode.FileMode { return f.mode }
+func (f *gitFile) Path() string            { return f.path }
+
+type gitChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c gitChunk) Content() string       { return c.content }
+func (c gitChunk) Type() fdiff.Operation { return c.op }
@@ -0,0 +1,154 @@
+package aico
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func writeFile(t *testing.T, fs billy.Filesystem, path, content string) {
+	t.Helper()
+	f, err := fs.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newMemoryRepository(t *testing.T) (*GoGitRepository, billy.Filesystem) {
+	t.Helper()
+	fs := memfs.New()
+	repo, err := git.Init(memory.NewStorage(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &GoGitRepository{
+		Repo:   repo,
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Unix(0, 0)},
+	}, fs
+}
+
+func TestGoGitRepository(t *testing.T) {
+	r, fs := newMemoryRepository(t)
+	wt, err := r.Repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	branch, err := r.CurrentBranch()
+	if err != nil || branch != "master" {
+		t.Errorf("Expected branch master before the first commit, got %q (%v)", branch, err)
+	}
+	if log, err := r.Log(5); err != nil || len(log) != 0 {
+		t.Errorf("Expected an empty log before the first commit, got %v (%v)", log, err)
+	}
+
+	writeFile(t, fs, "main.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, fs, "old.txt", "bye\n")
+	if _, err := wt.Add("."); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := r.StagedDiff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "diff --git a/main.go b/main.go\nnew file mode 100644\n") || !strings.Contains(diff, "+func main() {}\n") {
+		t.Errorf("Unexpected diff of the first commit:\n%s", diff)
+	}
+	if err := r.Commit("Initial commit"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stage a modification, a deletion and a new file, and leave a change unstaged
+	writeFile(t, fs, "main.go", "package main\n\nimport \"os\"\n\nfunc main() { os.Exit(1) }\n")
+	if _, err := wt.Add("main.go"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Remove("old.txt"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fs, "pkg/new.go", "package pkg\n")
+	if _, err := wt.Add("pkg/new.go"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fs, "main.go", "unstaged\n")
+
+	diff, err = r.StagedDiff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged, err := r.StagedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staged) != 3 || staged[0] != "main.go" || staged[1] != "old.txt" || staged[2] != "pkg/new.go" {
+		t.Errorf("Unexpected staged files: %q", staged)
+	}
+	files := ParseDiff(diff)
+	if len(files) != 3 || files[0].Path != "main.go" || files[1].Path != "old.txt" || files[2].Path != "pkg/new.go" {
+		t.Fatalf("Unexpected files in diff:\n%s", diff)
+	}
+	if added, deleted := files[0].Stat(); added != 3 || deleted != 1 {
+		t.Errorf("Expected +3 -1 in main.go, got +%d -%d:\n%s", added, deleted, diff)
+	}
+	if strings.Contains(diff, "unstaged") {
+		t.Errorf("Expected unstaged changes to be left out:\n%s", diff)
+	}
+	if !strings.Contains(diff, "deleted file mode 100644\n") || !strings.Contains(diff, "-bye\n") {
+		t.Errorf("Expected old.txt to be deleted:\n%s", diff)
+	}
+
+	if err := r.Commit("Exit with an error\n\nThe body."); err != nil {
+		t.Fatal(err)
+	}
+	log, err := r.Log(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Exit with an error\n\nThe body.", "Initial commit"}
+	if len(log) != len(expected) || log[0] != expected[0] || log[1] != expected[1] {
+		t.Errorf("Expected log %q, got %q", expected, log)
+	}
+	if log, _ := r.Log(1); len(log) != 1 {
+		t.Errorf("Expected the log to be limited to 1 commit, got %q", log)
+	}
+
+	if diff, err := r.StagedDiff(); err != nil || diff != "" {
+		t.Errorf("Expected no staged changes after the commit, got %q (%v)", diff, err)
+	}
+}
+
+func TestGoGitRepositoryConfig(t *testing.T) {
+	r, _ := newMemoryRepository(t)
+	cfg, err := r.Repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Raw.Section("core").SetOption("editor", "nano -w")
+	cfg.Raw.Section("branch").Subsection("main").SetOption("remote", "origin")
+	if err := r.Repo.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{
+		"core.editor":        "nano -w",
+		"branch.main.remote": "origin",
+		"core.pager-missing": "",
+	} {
+		if got, err := r.Config(key); err != nil || got != want {
+			t.Errorf("Config(%q) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+	if _, err := r.Config("editor"); err == nil {
+		t.Error("Expected an error for a key without a section")
+	}
+}
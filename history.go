@@ -0,0 +1,48 @@
+package aico
+
+import "strings"
+
+// HistoryExamples returns the subjects of up to n recent commits of repo that
+// show the style of the repository. Merge commits and fixup or squash commits
+// are left out, as are repeated subjects; the log is read further back in
+// their place until there are n subjects or the history runs out.
+func HistoryExamples(repo Repository, n int) ([]string, error) {
+	for limit := n; ; limit *= 2 {
+		messages, err := repo.Log(limit)
+		if err != nil {
+			return nil, err
+		}
+		subjects := historySubjects(messages)
+		if len(subjects) >= n || len(messages) < limit {
+			return subjects[:min(n, len(subjects))], nil
+		}
+	}
+}
+
+// historySubjects returns the subjects of messages, as returned by
+// Repository.Log, that were written by a person, without repetitions.
+func historySubjects(messages []string) []string {
+	var subjects []string
+	seen := make(map[string]bool)
+	for _, message := range messages {
+		subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+		subject = strings.TrimSpace(subject)
+		if subject == "" || seen[subject] || isGeneratedSubject(subject) {
+			continue
+		}
+		seen[subject] = true
+		subjects = append(subjects, subject)
+	}
+	return subjects
+}
+
+// isGeneratedSubject reports whether subject was written by git rather than
+// by a person.
+func isGeneratedSubject(subject string) bool {
+	for _, prefix := range []string{"Merge branch ", "Merge pull request ", "Merge remote-tracking branch ", "fixup! ", "squash! ", "amend! "} {
+		if strings.HasPrefix(subject, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package aico
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// logRepository is a Repository with a fixed log.
+type logRepository struct {
+	Repository
+	messages []string
+}
+
+func (r logRepository) Log(n int) ([]string, error) {
+	return r.messages[:min(n, len(r.messages))], nil
+}
+
+func TestHistoryExamples(t *testing.T) {
+	repo := logRepository{messages: []string{
+		"api: add pagination\n\nLong body.",
+		"Merge branch 'main' into feature",
+		"fixup! api: add pagination",
+		"  docs: fix typo  ",
+		"api: add pagination",
+		"Merge pull request #12 from feature",
+		"web: add search",
+		"build: bump Go",
+	}}
+	tests := []struct {
+		n        int
+		expected []string
+	}{
+		// The merge and fixup commits are replaced by older ones
+		{3, []string{"api: add pagination", "docs: fix typo", "web: add search"}},
+		{10, []string{"api: add pagination", "docs: fix typo", "web: add search", "build: bump Go"}},
+		{1, []string{"api: add pagination"}},
+	}
+	for _, tt := range tests {
+		got, err := HistoryExamples(repo, tt.n)
+		if err != nil || !slices.Equal(got, tt.expected) {
+			t.Errorf("HistoryExamples(%d) = %q, %v, want %q", tt.n, got, err, tt.expected)
+		}
+	}
+}
+
+func TestCreatePromptExamples(t *testing.T) {
+	opts := PromptOptions{NumCandidates: 3, RecentCommits: []string{"api: add pagination", "docs: fix typo"}}
+	prompt := mustCreatePrompt(t, "DIFF", opts)
+	if !strings.Contains(prompt, "---\napi: add pagination\ndocs: fix typo\n---\n") {
+		t.Errorf("Expected the examples in the prompt:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "Add search functionality to homepage") || strings.Contains(prompt, "Add diff loader module") {
+		t.Errorf("Expected the built-in samples to be replaced:\n%s", prompt)
+	}
+
+	opts.Conventional = true
+	if prompt := mustCreatePrompt(t, "DIFF", opts); !strings.Contains(prompt, "type(scope): subject") || strings.Contains(prompt, "feat(home)") {
+		t.Errorf("Expected the Conventional Commits rules without the built-in samples:\n%s", prompt)
+	}
+}
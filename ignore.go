@@ -0,0 +1,211 @@
+package aico
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile is the name of the file, in the root of the repository, that
+// lists the paths whose diff is not sent to the model. It uses gitignore syntax.
+const IgnoreFile = ".aicoignore"
+
+// DefaultIgnorePatterns are applied before the patterns of the IgnoreFile,
+// which can re-include them with a "!" pattern. They match files that take up
+// many tokens while saying little about the change.
+var DefaultIgnorePatterns = []string{
+	// Lockfiles and checksums
+	"go.sum",
+	"package-lock.json",
+	"yarn.lock",
+	"pnpm-lock.yaml",
+	"Cargo.lock",
+	"Gemfile.lock",
+	"poetry.lock",
+	"composer.lock",
+	// Generated code
+	"*.pb.go",
+	"*_pb2.py",
+	"*.gen.go",
+	// Vendored dependencies
+	"vendor/",
+	"node_modules/",
+	"third_party/",
+	// Minified and bundled assets
+	"*.min.js",
+	"*.min.css",
+	"*.js.map",
+}
+
+// IgnoreRules decides which paths are ignored, following gitignore rules:
+// the last matching pattern wins and "!" negates a pattern.
+type IgnoreRules struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// NewIgnoreRules compiles patterns in gitignore syntax.
+func NewIgnoreRules(patterns []string) *IgnoreRules {
+	r := &IgnoreRules{}
+	for _, p := range patterns {
+		r.add(p)
+	}
+	return r
+}
+
+// LoadIgnoreRules returns the DefaultIgnorePatterns followed by the patterns
+// of the IgnoreFile in the repository root, if there is one.
+func LoadIgnoreRules(root string) (*IgnoreRules, error) {
+	r := NewIgnoreRules(DefaultIgnorePatterns)
+	f, err := os.Open(filepath.Join(root, IgnoreFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r.add(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", IgnoreFile, err)
+	}
+	return r, nil
+}
+
+func (r *IgnoreRules) add(line string) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	p := ignorePattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:] // Escaped leading "#" or "!"
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	// A pattern with a slash other than at its end is relative to the root,
+	// otherwise it matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return
+	}
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return // Invalid patterns are ignored, as git does
+	}
+	p.re = re
+	r.patterns = append(r.patterns, p)
+}
+
+// globToRegexp translates a gitignore glob to a regular expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// Match reports whether the file at path, relative to the repository root,
+// is ignored. A pattern matching one of its parent directories ignores it too.
+func (r *IgnoreRules) Match(path string) bool {
+	ignored := false
+	for _, p := range r.patterns {
+		if p.matches(path) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func (p ignorePattern) matches(path string) bool {
+	if !p.dirOnly && p.re.MatchString(path) {
+		return true
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && p.re.MatchString(path[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterDiff replaces the diff of every ignored file with a one-line stub
+// that only tells how many lines were modified.
+func (r *IgnoreRules) FilterDiff(diff string) string {
+	if r == nil || len(r.patterns) == 0 {
+		return diff
+	}
+	files := ParseDiff(diff)
+	if len(files) == 0 {
+		return diff
+	}
+
+	var b strings.Builder
+	for _, f := range files {
+		if !r.Match(f.Path) {
+			b.WriteString(f.String())
+			continue
+		}
+		added, deleted := f.Stat()
+		fmt.Fprintf(&b, "%s\n%s: modified %d lines (+%d -%d), content omitted\n", f.Header[0], f.Path, added+deleted, added, deleted)
+	}
+	return b.String()
+}
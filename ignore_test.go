@@ -0,0 +1,103 @@
+package aico
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRulesMatch(t *testing.T) {
+	rules := NewIgnoreRules([]string{
+		"# comment",
+		"*.pb.go",
+		"vendor/",
+		"/build",
+		"docs/**/*.png",
+		"gen/**",
+		"*.log",
+		"!keep.log",
+		`\#hash`,
+	})
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"api/v1/service.pb.go", true},
+		{"service.go", false},
+		{"vendor/github.com/x/y.go", true},
+		{"third/vendor/z.go", true},
+		{"vendor", false}, // A file named like a directory pattern
+		{"build/out.bin", true},
+		{"cmd/build/main.go", false},
+		{"docs/a/b/c.png", true},
+		{"docs/c.png", true},
+		{"docs/c.jpg", false},
+		{"gen/a/b.go", true},
+		{"debug.log", true},
+		{"logs/keep.log", false},
+		{"#hash", true},
+	}
+	for _, tt := range tests {
+		if got := rules.Match(tt.path); got != tt.ignored {
+			t.Errorf("Match(%q) = %v, expected %v", tt.path, got, tt.ignored)
+		}
+	}
+}
+
+func TestFilterDiff(t *testing.T) {
+	diff := testDiff + `diff --git a/go.sum b/go.sum
+index 83db48f..bf269f4 100644
+--- a/go.sum
++++ b/go.sum
+@@ -1,2 +1,3 @@
+ github.com/a/b v1.0.0 h1:abc=
+-github.com/c/d v1.0.0 h1:def=
++github.com/c/d v1.1.0 h1:ghi=
++github.com/e/f v1.0.0 h1:jkl=
+`
+	filtered := NewIgnoreRules(DefaultIgnorePatterns).FilterDiff(diff)
+
+	if !strings.HasPrefix(filtered, testDiff) {
+		t.Errorf("Expected the diff of the other files to be kept, got %q", filtered)
+	}
+	stub := "diff --git a/go.sum b/go.sum\ngo.sum: modified 3 lines (+2 -1), content omitted\n"
+	if !strings.HasSuffix(filtered, stub) {
+		t.Errorf("Expected go.sum to be replaced with a stub, got %q", filtered)
+	}
+
+	var rules *IgnoreRules
+	if got := rules.FilterDiff(diff); got != diff {
+		t.Errorf("Expected nil rules to keep the diff, got %q", got)
+	}
+}
+
+func TestLoadIgnoreRules(t *testing.T) {
+	dir := t.TempDir()
+
+	rules, err := LoadIgnoreRules(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error without an ignore file: %v", err)
+	}
+	if !rules.Match("go.sum") {
+		t.Errorf("Expected the default patterns without an ignore file")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, IgnoreFile), []byte("*.snap\n!go.sum\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err = LoadIgnoreRules(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !rules.Match("ui/__snapshots__/app.snap") {
+		t.Errorf("Expected *.snap to be ignored")
+	}
+	if rules.Match("go.sum") {
+		t.Errorf("Expected !go.sum to re-include go.sum")
+	}
+	if !rules.Match("package-lock.json") {
+		t.Errorf("Expected the other defaults to apply")
+	}
+}
@@ -0,0 +1,35 @@
+package aico
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultLanguage is the language of the commit messages when none is set.
+const DefaultLanguage = "en"
+
+// Languages returns the sorted languages that have a built-in prompt.
+func Languages() []string {
+	languages := make([]string, 0, len(defaultPromptTemplates))
+	for lang := range defaultPromptTemplates {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// BaseLanguage returns the primary language subtag of a BCP 47 tag in lower
+// case, e.g. "pt" for "pt-BR". POSIX locales such as "de_DE.UTF-8" are
+// accepted too.
+func BaseLanguage(tag string) string {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	base, _, _ = strings.Cut(base, "_")
+	base, _, _ = strings.Cut(base, ".")
+	return base
+}
+
+// SupportsLanguage reports whether there is a built-in prompt for tag.
+func SupportsLanguage(tag string) bool {
+	_, ok := defaultPromptTemplates[BaseLanguage(tag)]
+	return ok
+}
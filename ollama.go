@@ -0,0 +1,184 @@
+package aico
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+type OllamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []OllamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  OllamaOptions   `json:"options"`
+}
+
+type OllamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type OllamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+	NumCtx      int     `json:"num_ctx,omitempty"`
+}
+
+type OllamaResponse struct {
+	Model   string        `json:"model"`
+	Message OllamaMessage `json:"message"`
+	Done    bool          `json:"done"`
+}
+
+// OllamaConfig is the environment configuration of the "ollama" provider.
+type OllamaConfig struct {
+	Host        string  `envconfig:"OLLAMA_HOST" default:"http://localhost:11434"`
+	Model       string  `envconfig:"OLLAMA_MODEL" default:"llama3.1"`
+	Temperature float64 `envconfig:"OLLAMA_TEMPERATURE" default:"0.1"`
+	MaxTokens   int     `envconfig:"OLLAMA_MAX_TOKENS" default:"450"`
+	NumCtx      int     `envconfig:"OLLAMA_NUM_CTX" default:"8192"` // Context window; Ollama's own default is much smaller
+}
+
+// OllamaProvider generates completions with a local Ollama server, so the
+// staged diff never leaves the machine.
+type OllamaProvider struct {
+	Host        string
+	Model       string
+	Temperature float64
+	MaxTokens   int
+	NumCtx      int // Context window size, 0 for the server default
+}
+
+// ollamaDefaultNumCtx is the context window Ollama uses unless num_ctx is set.
+const ollamaDefaultNumCtx = 2048
+
+func init() {
+	RegisterProvider("ollama", newOllamaProviderFromEnv)
+}
+
+func newOllamaProviderFromEnv() (Provider, error) {
+	var cfg OllamaConfig
+	if err := envconfig.Process("", &cfg); err != nil {
+		return nil, err
+	}
+	return &OllamaProvider{
+		Host:        cfg.Host,
+		Model:       cfg.Model,
+		Temperature: cfg.Temperature,
+		MaxTokens:   cfg.MaxTokens,
+		NumCtx:      cfg.NumCtx,
+	}, nil
+}
+
+// Name implements Provider.
+func (p *OllamaProvider) Name() string { return "ollama" }
+
+// chatURL returns the /api/chat endpoint of the server. OLLAMA_HOST is
+// commonly set without a scheme (e.g. "127.0.0.1:11434"), as the ollama CLI accepts that.
+func (p *OllamaProvider) chatURL() string {
+	host := strings.TrimRight(p.Host, "/")
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return host + "/api/chat"
+}
+
+// MaxPromptTokens implements TokenLimits. Unlike hosted APIs, the context
+// window of a local model is set per request with num_ctx.
+func (p *OllamaProvider) MaxPromptTokens() int {
+	numCtx := p.NumCtx
+	if numCtx <= 0 {
+		numCtx = ollamaDefaultNumCtx
+	}
+	return numCtx - p.MaxTokens
+}
+
+// EstimateTokens implements TokenLimits.
+func (p *OllamaProvider) EstimateTokens(text string) int {
+	return EstimateTokens(p.Model, text)
+}
+
+// Generate implements Provider.
+func (p *OllamaProvider) Generate(ctx context.Context, r Request) (Response, error) {
+	data := OllamaRequest{
+		Model:    p.Model,
+		Messages: ollamaMessages(r),
+		Stream:   false,
+		Options: OllamaOptions{
+			Temperature: p.Temperature,
+			NumPredict:  p.MaxTokens,
+			NumCtx:      p.NumCtx,
+		},
+	}
+	payloadBytes, err := json.Marshal(data)
+	if err != nil {
+		return Response{}, err
+	}
+	body := bytes.NewReader(payloadBytes)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.chatURL(), body)
+	if err != nil {
+		return Response{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, newAPIError("Ollama", resp, respBody)
+	}
+
+	if r.Verbose {
+		fmt.Printf("\nRaw response from Ollama: %v", string(respBody))
+	}
+
+	var apiResp OllamaResponse
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return Response{}, err
+	}
+
+	if content := strings.TrimSpace(apiResp.Message.Content); content != "" {
+		return Response{Text: content, Provider: p.Name()}, nil
+	}
+
+	return Response{}, fmt.Errorf("no response from Ollama")
+}
+
+// ollamaMessages returns the conversation of r as chat messages.
+func ollamaMessages(r Request) []OllamaMessage {
+	var messages []OllamaMessage
+	for _, m := range r.conversation() {
+		messages = append(messages, OllamaMessage{Role: m.Role, Content: m.Content})
+	}
+	return messages
+}
+
+// AskOllama sends a conversation, ending with the question, to the /api/chat endpoint of an Ollama server.
+func AskOllama(ctx context.Context, ollamaHost, ollamaModel string, ollamaTemperature float64, ollamaMaxTokens int, messages []Message, verbose bool) (string, error) {
+	p := &OllamaProvider{
+		Host:        ollamaHost,
+		Model:       ollamaModel,
+		Temperature: ollamaTemperature,
+		MaxTokens:   ollamaMaxTokens,
+	}
+	resp, err := p.Generate(ctx, Request{Messages: messages, Verbose: verbose})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
@@ -0,0 +1,77 @@
+package aico
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAskOllama(t *testing.T) {
+	// Create a mock server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("Expected path /api/chat, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Error("Content-Type header not set correctly")
+		}
+
+		// Parse request body
+		var reqBody OllamaRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Error("Failed to parse request body:", err)
+		}
+
+		// Check request body fields
+		if reqBody.Model != "llama-test-model" {
+			t.Errorf("Expected model to be llama-test-model, got %s", reqBody.Model)
+		}
+		if reqBody.Stream {
+			t.Error("Expected stream to be false")
+		}
+		if reqBody.Options.Temperature != 0.2 {
+			t.Errorf("Expected temperature to be 0.2, got %f", reqBody.Options.Temperature)
+		}
+		if reqBody.Options.NumPredict != 300 {
+			t.Errorf("Expected num_predict to be 300, got %d", reqBody.Options.NumPredict)
+		}
+		if len(reqBody.Messages) != 1 || reqBody.Messages[0].Role != "user" || reqBody.Messages[0].Content != "test question" {
+			t.Errorf("Unexpected messages field: %v", reqBody.Messages)
+		}
+
+		// Return mock response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"model": "llama-test-model", "message": {"role": "assistant", "content": "test response\n"}, "done": true}`))
+	}))
+	defer server.Close()
+
+	// OLLAMA_HOST is usually given without a scheme
+	host := strings.TrimPrefix(server.URL, "http://")
+	response, err := AskOllama(context.Background(), host, "llama-test-model", 0.2, 300, []Message{{Role: "user", Content: "test question"}}, false)
+
+	// Check results
+	if err != nil {
+		t.Error("Expected no error, got:", err)
+	}
+	if response != "test response" {
+		t.Errorf("Expected response to be 'test response', got: %s", response)
+	}
+}
+
+func TestAskOllamaError(t *testing.T) {
+	// Create a mock server that returns an error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "model 'llama-test-model' not found"}`))
+	}))
+	defer server.Close()
+
+	_, err := AskOllama(context.Background(), server.URL, "llama-test-model", 0.2, 300, []Message{{Role: "user", Content: "test question"}}, false)
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
@@ -2,11 +2,15 @@ package aico
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/kelseyhightower/envconfig"
 )
 
 type OpenAIRequest struct {
@@ -14,6 +18,42 @@ type OpenAIRequest struct {
 	Messages    []OpenAIMessage `json:"messages"`
 	MaxTokens   int             `json:"max_tokens"`
 	Temperature float64         `json:"temperature"`
+	Stream      bool            `json:"stream,omitempty"`
+
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
+}
+
+// OpenAIResponseFormat requests structured output following a JSON schema.
+type OpenAIResponseFormat struct {
+	Type       string `json:"type"` // "json_schema"
+	JSONSchema struct {
+		Name   string          `json:"name"`
+		Strict bool            `json:"strict"`
+		Schema json.RawMessage `json:"schema"`
+	} `json:"json_schema"`
+}
+
+// candidatesResponseFormat returns the response format of structured candidates.
+func candidatesResponseFormat() *OpenAIResponseFormat {
+	format := &OpenAIResponseFormat{Type: "json_schema"}
+	format.JSONSchema.Name = candidatesToolName
+	format.JSONSchema.Strict = true
+	format.JSONSchema.Schema = candidatesSchema
+	return format
+}
+
+// newOpenAIResponse builds the Response of a chat completion, decoding the
+// candidates when structured output was requested.
+func newOpenAIResponse(name, text string, structured bool) (Response, error) {
+	resp := Response{Text: strings.TrimSpace(text), Provider: name}
+	if structured {
+		candidates, err := parseCandidates(resp.Text)
+		if err != nil {
+			return Response{}, err
+		}
+		resp.Candidates = candidates
+	}
+	return resp, nil
 }
 
 type OpenAIMessage struct {
@@ -30,55 +70,325 @@ type OpenAIResponse struct {
 	} `json:"choices"`
 }
 
-func AskOpenAI(openAIURL, openAIKey, openAIModel string, openAITemperature float64, openAIMaxTokens int, question string, verbose bool) (string, error) {
+// OpenAIStreamChunk is a single server-sent event of a streamed chat completion.
+type OpenAIStreamChunk struct {
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// OpenAIConfig is the environment configuration of the "openai" provider.
+type OpenAIConfig struct {
+	Key          string            `envconfig:"OPENAI_API_KEY"`
+	BaseURL      string            `envconfig:"OPENAI_BASE_URL" default:"https://api.openai.com/v1"`
+	ExtraHeaders map[string]string `envconfig:"OPENAI_EXTRA_HEADERS"` // e.g. "HTTP-Referer:https://example.com,X-Title:git-aico"
+	Model        string            `envconfig:"OPENAI_MODEL" default:"gpt-4o"`
+	Temperature  float64           `envconfig:"OPENAI_TEMPERATURE" default:"0.1"`
+	MaxTokens    int               `envconfig:"OPENAI_MAX_TOKENS" default:"450"`
+}
+
+// OpenAICompatibleConfig is the environment configuration of the
+// "openai-compatible" provider. It is separate from OpenAIConfig so that a
+// provider list such as "openai-compatible,openai" can fall back to OpenAI,
+// and so that the OpenAI key is never sent to another server.
+type OpenAICompatibleConfig struct {
+	Key          string            `envconfig:"OPENAI_COMPATIBLE_API_KEY"`
+	BaseURL      string            `envconfig:"OPENAI_COMPATIBLE_BASE_URL"` // e.g. http://localhost:8000/v1
+	ExtraHeaders map[string]string `envconfig:"OPENAI_COMPATIBLE_EXTRA_HEADERS"`
+	Model        string            `envconfig:"OPENAI_COMPATIBLE_MODEL"`
+	Temperature  float64           `envconfig:"OPENAI_COMPATIBLE_TEMPERATURE" default:"0.1"`
+	MaxTokens    int               `envconfig:"OPENAI_COMPATIBLE_MAX_TOKENS" default:"450"`
+}
+
+// OpenAIProvider generates completions with the OpenAI chat completions API,
+// or with any server that implements it when Compatible is set.
+type OpenAIProvider struct {
+	URL         string
+	Key         string // Optional when Compatible is set
+	Model       string
+	Temperature float64
+	MaxTokens   int
+	Headers     map[string]string // Extra headers sent with every request
+
+	// Compatible relaxes the response validation for servers such as vLLM,
+	// LM Studio or llama.cpp that omit fields like the choice role.
+	Compatible bool
+}
+
+func init() {
+	RegisterProvider("openai", newOpenAIProviderFromEnv)
+	RegisterProvider("openai-compatible", newOpenAICompatibleProviderFromEnv)
+}
+
+func newOpenAIProviderFromEnv() (Provider, error) {
+	var cfg OpenAIConfig
+	if err := envconfig.Process("", &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Key == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is required when MODEL_PROVIDER=openai")
+	}
+	return newOpenAIProvider(cfg, false), nil
+}
+
+func newOpenAICompatibleProviderFromEnv() (Provider, error) {
+	var cfg OpenAICompatibleConfig
+	if err := envconfig.Process("", &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("OPENAI_COMPATIBLE_BASE_URL is required when MODEL_PROVIDER=openai-compatible")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("OPENAI_COMPATIBLE_MODEL is required when MODEL_PROVIDER=openai-compatible")
+	}
+	return newOpenAIProvider(OpenAIConfig(cfg), true), nil
+}
+
+func newOpenAIProvider(cfg OpenAIConfig, compatible bool) *OpenAIProvider {
+	return &OpenAIProvider{
+		URL:         chatCompletionsURL(cfg.BaseURL),
+		Key:         cfg.Key,
+		Model:       cfg.Model,
+		Temperature: cfg.Temperature,
+		MaxTokens:   cfg.MaxTokens,
+		Headers:     cfg.ExtraHeaders,
+		Compatible:  compatible,
+	}
+}
+
+// chatCompletionsURL appends the chat completions path to an API base URL
+// such as "http://localhost:8000/v1".
+func chatCompletionsURL(baseURL string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if strings.HasSuffix(baseURL, "/chat/completions") {
+		return baseURL
+	}
+	return baseURL + "/chat/completions"
+}
+
+// Name implements Provider.
+func (p *OpenAIProvider) Name() string {
+	if p.Compatible {
+		return "openai-compatible"
+	}
+	return "openai"
+}
+
+// MaxPromptTokens implements TokenLimits.
+func (p *OpenAIProvider) MaxPromptTokens() int {
+	return modelTokenLimits{p.Model, p.MaxTokens}.MaxPromptTokens()
+}
+
+// EstimateTokens implements TokenLimits.
+func (p *OpenAIProvider) EstimateTokens(text string) int {
+	return EstimateTokens(p.Model, text)
+}
+
+// Generate implements Provider.
+func (p *OpenAIProvider) Generate(ctx context.Context, r Request) (Response, error) {
+	data := p.request(r)
+	apiResp, err := postOpenAIChat(ctx, p.Name(), p.URL, p.headers(), data, r.Verbose)
+	if dropResponseFormat(p.Name(), &data, err, r.Verbose) {
+		apiResp, err = postOpenAIChat(ctx, p.Name(), p.URL, p.headers(), data, r.Verbose)
+	}
+	if err != nil {
+		return Response{}, err
+	}
+
+	if len(apiResp.Choices) > 0 && p.acceptRole(apiResp.Choices[0].Message.Role) {
+		// Extract the content from the assistant's message
+		return newOpenAIResponse(p.Name(), apiResp.Choices[0].Message.Content, data.ResponseFormat != nil)
+	}
+
+	return Response{}, fmt.Errorf("no response from %s", p.Name())
+}
+
+// GenerateStream implements StreamingProvider.
+func (p *OpenAIProvider) GenerateStream(ctx context.Context, r Request, onText func(string)) (Response, error) {
+	data := p.request(r)
+	data.Stream = true
+	text, err := streamOpenAIChat(ctx, p.Name(), p.URL, p.headers(), data, r.Verbose, onText)
+	if dropResponseFormat(p.Name(), &data, err, r.Verbose) {
+		text, err = streamOpenAIChat(ctx, p.Name(), p.URL, p.headers(), data, r.Verbose, onText)
+	}
+	if err != nil {
+		return Response{}, err
+	}
+	if text == "" {
+		return Response{}, fmt.Errorf("no response from %s", p.Name())
+	}
+	return newOpenAIResponse(p.Name(), text, data.ResponseFormat != nil)
+}
+
+// dropResponseFormat removes the response format from data when err shows
+// that the server rejected it, as older models such as gpt-4, older Azure API
+// versions and other servers behind OPENAI_BASE_URL do. It reports whether
+// data should be sent again, so that the answer is parsed as plain text.
+func dropResponseFormat(name string, data *OpenAIRequest, err error, verbose bool) bool {
+	var apiErr *APIError
+	if data.ResponseFormat == nil || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest ||
+		!strings.Contains(apiErr.Body, "response_format") {
+		return false
+	}
+	if verbose {
+		fmt.Printf("\n%s does not support structured output, asking for plain text\n", name)
+	}
+	data.ResponseFormat = nil
+	return true
+}
+
+// structured reports whether structured output is used for r. Compatible
+// servers are not assumed to support JSON schemas and answer with plain text.
+func (p *OpenAIProvider) structured(r Request) bool {
+	return r.Structured && !p.Compatible
+}
+
+func (p *OpenAIProvider) request(r Request) OpenAIRequest {
 	data := OpenAIRequest{
-		Messages:    []OpenAIMessage{{Role: "user", Content: question}},
-		Model:       openAIModel,       // Use the model from the configuration
-		Temperature: openAITemperature, // Use the temperature from the configuration
-		MaxTokens:   openAIMaxTokens,   // Use the max tokens from the configuration
+		Messages:    openAIMessages(r),
+		Model:       p.Model,       // Use the model from the configuration
+		Temperature: p.Temperature, // Use the temperature from the configuration
+		MaxTokens:   p.MaxTokens,   // Use the max tokens from the configuration
+	}
+	if p.structured(r) {
+		data.ResponseFormat = candidatesResponseFormat()
 	}
+	return data
+}
+
+// openAIMessages returns the conversation of r as chat completion messages.
+func openAIMessages(r Request) []OpenAIMessage {
+	var messages []OpenAIMessage
+	for _, m := range r.conversation() {
+		messages = append(messages, OpenAIMessage{Role: m.Role, Content: m.Content})
+	}
+	return messages
+}
+
+func (p *OpenAIProvider) headers() map[string]string {
+	headers := map[string]string{}
+	if p.Key != "" {
+		headers["Authorization"] = "Bearer " + p.Key
+	}
+	for k, v := range p.Headers {
+		headers[k] = v
+	}
+	return headers
+}
+
+// sendOpenAIChat posts a chat completions request and returns the response
+// once it is known to be successful. The caller must close its body.
+func sendOpenAIChat(ctx context.Context, name, url string, headers map[string]string, data OpenAIRequest) (*http.Response, error) {
 	payloadBytes, err := json.Marshal(data)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	body := bytes.NewReader(payloadBytes)
 
-	req, err := http.NewRequest("POST", openAIURL, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+openAIKey)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(name, resp, respBody)
+	}
+	return resp, nil
+}
 
-	respBody, err := io.ReadAll(resp.Body)
+// postOpenAIChat sends a chat completions request and decodes the response.
+// It is shared by every provider speaking the OpenAI wire format.
+func postOpenAIChat(ctx context.Context, name, url string, headers map[string]string, data OpenAIRequest, verbose bool) (OpenAIResponse, error) {
+	resp, err := sendOpenAIChat(ctx, name, url, headers, data)
 	if err != nil {
-		return "", err
+		return OpenAIResponse{}, err
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("received non-OK HTTP status from OpenAI: %s, response body: %s", resp.Status, string(respBody))
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return OpenAIResponse{}, err
 	}
 
 	if verbose {
-		fmt.Printf("\nRaw response from OpenAI: %v", string(respBody)) // Debugging line to print raw response
+		fmt.Printf("\nRaw response from %s: %v", name, string(respBody)) // Debugging line to print raw response
 	}
 
 	var apiResp OpenAIResponse
 	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return OpenAIResponse{}, err
+	}
+	return apiResp, nil
+}
+
+// streamOpenAIChat sends a streamed chat completions request, calls onText
+// for every content delta and returns the complete, trimmed text.
+func streamOpenAIChat(ctx context.Context, name, url string, headers map[string]string, data OpenAIRequest, verbose bool, onText func(string)) (string, error) {
+	resp, err := sendOpenAIChat(ctx, name, url, headers, data)
+	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
 
-	if len(apiResp.Choices) > 0 && apiResp.Choices[0].Message.Role == "assistant" {
-		// Extract the content from the assistant's message
-		//fmt.Println(apiResp.Choices[0].Message.Content)
-		return strings.TrimSpace(apiResp.Choices[0].Message.Content), nil
+	var text strings.Builder
+	err = readSSE(resp.Body, func(event, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return err
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			text.WriteString(chunk.Choices[0].Delta.Content)
+			onText(chunk.Choices[0].Delta.Content)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
 
-	return "", fmt.Errorf("no response from OpenAI")
+	if verbose {
+		fmt.Printf("\nRaw streamed response from %s: %v", name, text.String())
+	}
+	return strings.TrimSpace(text.String()), nil
+}
+
+// acceptRole reports whether a choice with the given role is an answer.
+// Compatible servers may leave the role empty.
+func (p *OpenAIProvider) acceptRole(role string) bool {
+	return role == "assistant" || (p.Compatible && role == "")
+}
+
+// AskOpenAI sends a conversation, ending with the question, to the OpenAI chat completions API.
+func AskOpenAI(ctx context.Context, openAIURL, openAIKey, openAIModel string, openAITemperature float64, openAIMaxTokens int, messages []Message, verbose bool) (string, error) {
+	p := &OpenAIProvider{
+		URL:         openAIURL,
+		Key:         openAIKey,
+		Model:       openAIModel,
+		Temperature: openAITemperature,
+		MaxTokens:   openAIMaxTokens,
+	}
+	resp, err := p.Generate(ctx, Request{Messages: messages, Verbose: verbose})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
 }
@@ -0,0 +1,203 @@
+package aico
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAskOpenAI(t *testing.T) {
+	// Create a mock server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Check headers
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Error("Content-Type header not set correctly")
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Error("Authorization header not set correctly")
+		}
+
+		// Parse request body
+		var reqBody OpenAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Error("Failed to parse request body:", err)
+		}
+		if reqBody.Model != "gpt-test-model" {
+			t.Errorf("Expected model to be gpt-test-model, got %s", reqBody.Model)
+		}
+		if len(reqBody.Messages) != 3 || reqBody.Messages[1].Role != "assistant" || reqBody.Messages[2].Role != "user" || reqBody.Messages[2].Content != "shorter" {
+			t.Errorf("Unexpected messages field: %v", reqBody.Messages)
+		}
+
+		// Return mock response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "test response"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	messages := []Message{
+		{Role: "user", Content: "test question"},
+		{Role: "assistant", Content: "- Add a long commit message"},
+		{Role: "user", Content: "shorter"},
+	}
+	response, err := AskOpenAI(context.Background(), server.URL, "test-key", "gpt-test-model", 0.2, 300, messages, false)
+	if err != nil {
+		t.Error("Expected no error, got:", err)
+	}
+	if response != "test response" {
+		t.Errorf("Expected response to be 'test response', got: %s", response)
+	}
+}
+
+func TestOpenAICompatibleProvider(t *testing.T) {
+	// A server that, like some local inference servers, omits the role
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Expected path /v1/chat/completions, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Error("Expected no Authorization header without a key")
+		}
+		if r.Header.Get("X-Title") != "git-aico" {
+			t.Error("Extra header not set correctly")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"content": "test response"}}]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("OPENAI_COMPATIBLE_BASE_URL", server.URL+"/v1/")
+	t.Setenv("OPENAI_COMPATIBLE_EXTRA_HEADERS", "X-Title:git-aico")
+	t.Setenv("OPENAI_COMPATIBLE_MODEL", "qwen2.5")
+	t.Setenv("OPENAI_COMPATIBLE_API_KEY", "")
+	// The OpenAI key must not be sent to another server
+	t.Setenv("OPENAI_API_KEY", "openai-key")
+	p, err := NewProvider("openai-compatible")
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+
+	resp, err := p.Generate(context.Background(), Request{Prompt: "test question"})
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if resp.Text != "test response" {
+		t.Errorf("Expected response to be 'test response', got: %s", resp.Text)
+	}
+
+	// OPENAI_BASE_URL does not configure the compatible provider
+	t.Setenv("OPENAI_COMPATIBLE_BASE_URL", "")
+	t.Setenv("OPENAI_BASE_URL", server.URL+"/v1")
+	if _, err := NewProvider("openai-compatible"); err == nil {
+		t.Error("Expected an error for missing OPENAI_COMPATIBLE_BASE_URL, got nil")
+	}
+
+	// The strict provider still rejects a choice without the assistant role
+	strict := &OpenAIProvider{URL: server.URL + "/v1/chat/completions", Headers: map[string]string{"X-Title": "git-aico"}}
+	if _, err := strict.Generate(context.Background(), Request{Prompt: "test question"}); err == nil {
+		t.Error("Expected an error from the strict provider, got nil")
+	}
+}
+
+func TestOpenAIProviderStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody OpenAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Error("Failed to parse request body:", err)
+		}
+		if !reqBody.Stream {
+			t.Error("Expected stream to be true")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\": [{\"index\": 0, \"delta\": {\"role\": \"assistant\", \"content\": \"\"}}]}\n\n" +
+			": keep-alive\n\n" +
+			"data: {\"choices\": [{\"index\": 0, \"delta\": {\"content\": \"- Fix \"}}]}\n\n" +
+			"data: {\"choices\": [{\"index\": 0, \"delta\": {\"content\": \"login bug\"}}]}\n\n" +
+			"data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	p := &OpenAIProvider{URL: server.URL, Key: "test-key", Model: "gpt-test-model"}
+	var chunks []string
+	resp, err := p.GenerateStream(context.Background(), Request{Prompt: "test question"}, func(text string) {
+		chunks = append(chunks, text)
+	})
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if resp.Text != "- Fix login bug" {
+		t.Errorf("Expected response to be '- Fix login bug', got: %q", resp.Text)
+	}
+	if len(chunks) != 2 {
+		t.Errorf("Unexpected chunks: %q", chunks)
+	}
+}
+
+func TestOpenAIProviderStructured(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody OpenAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Error("Failed to parse request body:", err)
+		}
+		if reqBody.ResponseFormat == nil || reqBody.ResponseFormat.Type != "json_schema" || !reqBody.ResponseFormat.JSONSchema.Strict {
+			t.Errorf("Unexpected response_format: %+v", reqBody.ResponseFormat)
+		}
+
+		content, _ := json.Marshal(`{"candidates": [{"subject": "Add search to homepage", "body": "", "type": "feat", "scope": "web"}]}`)
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": ` + string(content) + `}}]}`))
+	}))
+	defer server.Close()
+
+	p := &OpenAIProvider{URL: server.URL, Key: "test-key", Model: "gpt-test-model"}
+	resp, err := p.Generate(context.Background(), Request{Prompt: "test question", Structured: true})
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	want := Candidate{Subject: "Add search to homepage", Type: "feat", Scope: "web"}
+	if len(resp.Candidates) != 1 || resp.Candidates[0] != want {
+		t.Errorf("Unexpected candidates: %+v", resp.Candidates)
+	}
+}
+
+func TestOpenAIProviderStructuredUnsupported(t *testing.T) {
+	// A model without JSON schema support rejects the response format
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var reqBody OpenAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Error("Failed to parse request body:", err)
+		}
+		if reqBody.ResponseFormat != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"message": "Invalid parameter: 'response_format' of type 'json_schema' is not supported with this model.", "param": "response_format"}}`))
+			return
+		}
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "- Add search to homepage"}}]}`))
+	}))
+	defer server.Close()
+
+	p := &OpenAIProvider{URL: server.URL, Key: "test-key", Model: "gpt-4"}
+	resp, err := p.Generate(context.Background(), Request{Prompt: "test question", Structured: true})
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if requests != 2 || resp.Candidates != nil || resp.Text != "- Add search to homepage" {
+		t.Errorf("Expected a plain text response after %d requests, got %+v", requests, resp)
+	}
+
+	// Other bad requests are not repeated
+	requests = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "Invalid model"}}`))
+	})
+	if _, err := p.Generate(context.Background(), Request{Prompt: "test question", Structured: true}); err == nil || requests != 1 {
+		t.Errorf("Expected a single failed request, got %d, %v", requests, err)
+	}
+}
@@ -1,104 +1,244 @@
 package aico
 
-import "fmt"
-
-// CreateAIQuestion formats a question for AI API based on the git diff output.
-func CreateAIQuestion(diffOutput string, numCandidates int, japaneseOutput bool) string {
-	prompt := `
-Please generate %d appropriate commit message candidates based on git diff.
-(Do NOT number at the beginning of the line)
-
-sample of commit messages:
----
-
-# Adding a new feature
-Add search functionality to homepage
-
-# Bug fix
-Fix bug causing app crash on login
-
-# Code refactoring
-Refactor data parsing function for readability
-
-# Adding a test
-Add unit tests for user registration
-
-# Document update
-Update README with new installation instructions
-
-# Performance improvement
-Improve loading speed of product images
-
-# Dependency update
-Update lodash to version 4.17.21
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// PromptOptions controls what kind of commit messages the prompt asks for.
+type PromptOptions struct {
+	NumCandidates int
+	Language      string // BCP 47 tag of the language of the messages, DefaultLanguage if empty
+	Conventional  bool   // Ask for Conventional Commits messages, see RepairConventional
+	Scope         string // Scope suggested for Conventional Commits messages, see InferScope
+	Body          bool   // Ask for a body explaining the change below the subject line
+
+	// RecentCommits are commit subjects of the repository, see
+	// HistoryExamples. They replace the built-in samples so that the style of
+	// the repository is followed.
+	RecentCommits []string
+
+	Branch   string   // Current branch, see Repository.CurrentBranch
+	FileList []string // Staged files, see Repository.StagedFiles
+
+	// Template replaces the built-in prompt, see LoadPromptTemplate
+	Template *template.Template
+}
 
-# Removing unnecessary code
-Remove deprecated API endpoints
+// PromptData is the data prompt templates are executed with. The "exclude"
+// template of follow-up questions is executed with the list of messages that
+// were already suggested instead, and the "feedback" template with FeedbackData.
+type PromptData struct {
+	Diff          string
+	NumCandidates int
+	Branch        string
+	FileList      []string
+	RecentCommits []string
+	Language      string // BCP 47 tag of the language of the messages, e.g. "en" or "ja"
+	Conventional  bool
+	Scope         string
+	Body          bool
+}
 
-# UI/UX enhancement
-Enhance user interface for mobile view
+// PromptTemplateFile is the path, relative to the repository root, of the
+// template that replaces the built-in prompt.
+const PromptTemplateFile = ".aico/prompt.tmpl"
 
-# Adding or modifying code comments
-Update comments in the routing module
----
+//go:embed templates/*.tmpl
+var promptTemplatesFS embed.FS
 
-output format:
-- Add diff loader module for handling Git diffs
-- Implement diff loading from file and Git in diffloader.ts
-- Create diffloader.ts to process and split Git diffs
+// promptFuncs are the functions available in prompt templates.
+var promptFuncs = template.FuncMap{
+	"join":              strings.Join,
+	"conventionalTypes": func() []string { return ConventionalTypes },
+}
 
-git diff:
----
+// defaultPromptTemplates are the built-in prompts by base language, one
+// file per language in the templates directory.
+var defaultPromptTemplates = mustParseDefaultPromptTemplates()
 
-%s`
-	if japaneseOutput {
-		prompt = `
-git diffの内容に基づいて、%d個の適切なコミットメッセージ候補を日本語で生成してください。
-なお候補の先頭に1. 2. 3. などの番号は付けないでください。
+func mustParseDefaultPromptTemplates() map[string]*template.Template {
+	files, err := fs.Glob(promptTemplatesFS, "templates/*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+	templates := make(map[string]*template.Template, len(files))
+	for _, file := range files {
+		text, err := promptTemplatesFS.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		lang := strings.TrimSuffix(path.Base(file), ".tmpl")
+		templates[lang] = template.Must(ParsePromptTemplate(lang, string(text)))
+	}
+	return templates
+}
 
-コミットメッセージのサンプル:
----
+// ParsePromptTemplate parses a prompt template in text/template syntax. It
+// is executed with PromptData and may define an "exclude" template for
+// follow-up questions and a "feedback" template executed with FeedbackData;
+// otherwise those of the built-in prompt are used.
+func ParsePromptTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(promptFuncs).Parse(text)
+}
 
-# 新機能の追加
-ホームページに検索機能を追加
+// LoadPromptTemplate parses the first of paths that exists, typically the
+// PromptTemplateFile of the repository followed by a global template. It
+// returns nil if none exists.
+func LoadPromptTemplate(paths ...string) (*template.Template, error) {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		text, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		t, err := ParsePromptTemplate(path, string(text))
+		if err != nil {
+			return nil, fmt.Errorf("parsing prompt template: %w", err)
+		}
+		return t, nil
+	}
+	return nil, nil
+}
 
-# バグ修正
-ログイン時にアプリがクラッシュするバグを修正
+// language returns the BCP 47 tag of the language of the messages.
+func (opts PromptOptions) language() string {
+	if opts.Language == "" {
+		return DefaultLanguage
+	}
+	return opts.Language
+}
 
-# コードのリファクタリング
-可読性のためにデータ解析関数をリファクタリング
+// template returns the named template of the prompt, the prompt itself if
+// name is empty. A custom Template may be used with any language; the
+// templates it does not define are taken from the built-in prompt of the
+// language, or the English one if there is none.
+func (opts PromptOptions) template(name string) (*template.Template, error) {
+	builtin, ok := defaultPromptTemplates[BaseLanguage(opts.language())]
+	if !ok {
+		if opts.Template == nil {
+			return nil, fmt.Errorf("no built-in prompt for language %q (supported languages: %s)", opts.language(), strings.Join(Languages(), ", "))
+		}
+		builtin = defaultPromptTemplates[DefaultLanguage]
+	}
+	if opts.Template != nil {
+		if name == "" {
+			return opts.Template, nil
+		}
+		if t := opts.Template.Lookup(name); t != nil {
+			return t, nil
+		}
+	}
+	if name == "" {
+		return builtin, nil
+	}
+	return builtin.Lookup(name), nil
+}
 
-# テストの追加
-ユーザー登録の単体テストを追加
+// execute executes the named template of the prompt with data.
+func (opts PromptOptions) execute(name string, data any) (string, error) {
+	t, err := opts.template(name)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("executing prompt template: %w", err)
+	}
+	return b.String(), nil
+}
 
-# ドキュメントの更新
-新しいインストール手順でREADMEを更新
+// CreatePrompt formats a question for AI API based on the git diff output.
+func CreatePrompt(diffOutput string, opts PromptOptions) (string, error) {
+	return opts.execute("", PromptData{
+		Diff:          diffOutput,
+		NumCandidates: opts.NumCandidates,
+		Branch:        opts.Branch,
+		FileList:      opts.FileList,
+		RecentCommits: opts.RecentCommits,
+		Language:      opts.language(),
+		Conventional:  opts.Conventional,
+		Scope:         opts.Scope,
+		Body:          opts.Body,
+	})
+}
 
-# パフォーマンスの向上
-製品画像の読み込み速度を向上
+// CreateAdditionalPrompt formats a follow-up question for opts.NumCandidates
+// more commit message candidates, which must differ from the existing ones.
+func CreateAdditionalPrompt(diffOutput string, opts PromptOptions, existing []string) (string, error) {
+	prompt, err := CreatePrompt(diffOutput, opts)
+	if err != nil {
+		return "", err
+	}
+	exclude, err := opts.execute("exclude", existing)
+	if err != nil {
+		return "", err
+	}
+	return prompt + exclude, nil
+}
 
-# 依存関係の更新
-lodashをバージョン4.17.21に更新
+// FeedbackData is the data the "feedback" template is executed with.
+type FeedbackData struct {
+	Feedback      string // Free-form feedback of the user, e.g. "shorter"
+	NumCandidates int
+}
 
-# 不要なコードの削除
-廃止されたAPIエンドポイントを削除
+// CreateFeedbackPrompt formats a question that continues the conversation
+// about the candidates suggested so far, asking for opts.NumCandidates new
+// ones that take feedback into account. Messages in existing must not be
+// repeated.
+func CreateFeedbackPrompt(feedback string, opts PromptOptions, existing []string) (string, error) {
+	prompt, err := opts.execute("feedback", FeedbackData{Feedback: strings.TrimSpace(feedback), NumCandidates: opts.NumCandidates})
+	if err != nil {
+		return "", err
+	}
+	if len(existing) == 0 {
+		return prompt, nil
+	}
+	exclude, err := opts.execute("exclude", existing)
+	if err != nil {
+		return "", err
+	}
+	return prompt + exclude, nil
+}
 
-# UI/UXの改善
-モバイルビューのユーザーインターフェースを改善
+// CreateAIQuestion formats a question for AI API based on the git diff output.
+func CreateAIQuestion(diffOutput string, numCandidates int, japaneseOutput bool) string {
+	// The built-in templates cannot fail
+	prompt, _ := CreatePrompt(diffOutput, PromptOptions{NumCandidates: numCandidates, Language: japaneseLanguage(japaneseOutput)})
+	return prompt
+}
 
-# コードコメントの追加または変更
-ルーティングモジュールのコメントを更新
----
+// japaneseLanguage returns the language of the -j flag of earlier versions.
+func japaneseLanguage(japaneseOutput bool) string {
+	if japaneseOutput {
+		return "ja"
+	}
+	return DefaultLanguage
+}
 
-出力形式:
-- Gitの差分を処理するためのdiffローダーモジュールを追加
-- diffloader.tsでファイルとGitからの差分の読み込みを実装
-- Gitの差分を処理し、分割するためのdiffloader.tsを作成
+// CreateSummaryQuestion formats a question asking for a summary of one part of
+// a diff that is too large to send at once, see SummarizeDiff.
+func CreateSummaryQuestion(diffChunk string) string {
+	prompt := `
+The following is one part of a large git diff. Summarise what changed in it
+as a few short bullet points, naming the files, functions and dependencies
+involved. Do not speculate about the other parts.
 
 git diff:
 ---
 
 %s`
-	}
-	return fmt.Sprintf(prompt, numCandidates, diffOutput)
+	return fmt.Sprintf(prompt, diffChunk)
 }
@@ -0,0 +1,152 @@
+package aico
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustCreatePrompt(t *testing.T, diff string, opts PromptOptions) string {
+	t.Helper()
+	prompt, err := CreatePrompt(diff, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prompt
+}
+
+func TestPromptTemplate(t *testing.T) {
+	tmpl, err := ParsePromptTemplate("test", `{{.NumCandidates}} for {{.Branch}} in {{.Language}}: {{join .FileList ","}}
+{{range .RecentCommits}}* {{.}}
+{{end}}{{.Diff}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := PromptOptions{
+		NumCandidates: 2,
+		Language:      "ja-JP",
+		RecentCommits: []string{"a", "b"},
+		Branch:        "main",
+		FileList:      []string{"x.go", "y.go"},
+		Template:      tmpl,
+	}
+	expected := "2 for main in ja-JP: x.go,y.go\n* a\n* b\nDIFF"
+	if got := mustCreatePrompt(t, "DIFF", opts); got != expected {
+		t.Errorf("CreatePrompt() = %q, want %q", got, expected)
+	}
+
+	// Without an "exclude" template the built-in one of the language is used
+	got, err := CreateAdditionalPrompt("DIFF", opts, []string{"m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, expected) || !strings.HasSuffix(got, "以下のコミットメッセージは既に提案済みです。これらと重複しない候補を生成してください:\n- m\n") {
+		t.Errorf("Unexpected follow-up prompt: %q", got)
+	}
+
+	opts.Template, err = ParsePromptTemplate("test", `{{.Diff}}{{define "exclude"}} not {{join . ", "}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := CreateAdditionalPrompt("DIFF", opts, []string{"m", "n"}); got != "DIFF not m, n" {
+		t.Errorf("Expected the template's exclude, got %q", got)
+	}
+	if got, _ := CreateFeedbackPrompt("shorter", opts, []string{"m"}); !strings.Contains(got, "フィードバック:\n---\nshorter\n") || !strings.HasSuffix(got, " not m") {
+		t.Errorf("Expected the built-in feedback and the template's exclude, got %q", got)
+	}
+
+	opts.Template, err = ParsePromptTemplate("test", `{{.Diff}}{{define "feedback"}}{{.NumCandidates}} but {{.Feedback}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := CreateFeedbackPrompt(" shorter\n", opts, nil); got != "2 but shorter" {
+		t.Errorf("Expected the template's feedback, got %q", got)
+	}
+
+	opts.Template, err = ParsePromptTemplate("test", `{{index .FileList 5}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreatePrompt("DIFF", opts); err == nil {
+		t.Errorf("Expected an error executing the template")
+	}
+}
+
+func TestLoadPromptTemplate(t *testing.T) {
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo.tmpl")
+	global := filepath.Join(dir, "global.tmpl")
+
+	tmpl, err := LoadPromptTemplate(repo, "", global)
+	if err != nil || tmpl != nil {
+		t.Fatalf("Expected no template, got %v (%v)", tmpl, err)
+	}
+
+	if err := os.WriteFile(global, []byte("global {{.Diff}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(repo, []byte("repo {{.Diff}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err = LoadPromptTemplate(repo, global)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustCreatePrompt(t, "DIFF", PromptOptions{Template: tmpl}); got != "repo DIFF" {
+		t.Errorf("Expected the repository template first, got %q", got)
+	}
+
+	if err := os.WriteFile(repo, []byte("{{.Diff"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPromptTemplate(repo, global); err == nil {
+		t.Errorf("Expected a parse error")
+	}
+}
+
+func TestCreatePromptLanguages(t *testing.T) {
+	for lang, expected := range map[string]string{
+		"":      "Please generate 3 appropriate",
+		"en-US": "Please generate 3 appropriate",
+		"ja":    "3個の適切なコミットメッセージ候補を日本語で",
+		"ko-KR": "커밋 메시지 후보를 3개 한국어로",
+		"de_DE": "3 passende Vorschläge für Commit-Nachrichten auf Deutsch",
+		"es":    "Genera 3 propuestas de mensajes de commit adecuados en español",
+	} {
+		for _, opts := range []PromptOptions{
+			{NumCandidates: 3, Language: lang},
+			{NumCandidates: 3, Language: lang, Conventional: true, Scope: "billing"},
+			{NumCandidates: 3, Language: lang, RecentCommits: []string{"x"}},
+			{NumCandidates: 3, Language: lang, Conventional: true, Body: true},
+		} {
+			prompt := mustCreatePrompt(t, "DIFF", opts)
+			if !strings.Contains(prompt, expected) || !strings.HasSuffix(prompt, "\ngit diff:\n---\n\nDIFF") {
+				t.Errorf("Unexpected prompt for %+v:\n%s", opts, prompt)
+			}
+			if opts.Body != strings.Contains(prompt, "\n---\n<") {
+				t.Errorf("Expected the body instructions only for %+v:\n%s", opts, prompt)
+			}
+			if opts.Scope != "" && !strings.Contains(prompt, "billing") {
+				t.Errorf("Expected the scope hint for %+v:\n%s", opts, prompt)
+			}
+		}
+		if got, _ := CreateAdditionalPrompt("DIFF", PromptOptions{Language: lang}, []string{"m"}); !strings.HasSuffix(got, "\n- m\n") {
+			t.Errorf("Unexpected follow-up prompt for %q:\n%s", lang, got)
+		}
+		if got, _ := CreateFeedbackPrompt("shorter", PromptOptions{NumCandidates: 2, Language: lang}, []string{"m"}); !strings.Contains(got, "2") || !strings.Contains(got, "\n---\nshorter\n") || !strings.HasSuffix(got, "\n- m\n") {
+			t.Errorf("Unexpected feedback prompt for %q:\n%s", lang, got)
+		}
+	}
+
+	if _, err := CreatePrompt("DIFF", PromptOptions{Language: "pt-BR"}); err == nil || !strings.Contains(err.Error(), "de, en, es, ja, ko") {
+		t.Errorf("Expected an error listing the supported languages, got %v", err)
+	}
+	tmpl, err := ParsePromptTemplate("test", "{{.Language}}: {{.Diff}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustCreatePrompt(t, "DIFF", PromptOptions{Language: "pt-BR", Template: tmpl}); got != "pt-BR: DIFF" {
+		t.Errorf("Expected a custom template to support any language, got %q", got)
+	}
+}
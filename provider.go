@@ -0,0 +1,101 @@
+package aico
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Message is a turn of a conversation with a Provider.
+type Message struct {
+	Role    string // "user" or "assistant"
+	Content string
+}
+
+// Request is a single generation request sent to a Provider.
+type Request struct {
+	Prompt  string
+	Verbose bool // Print the raw response from the provider
+
+	// Messages are the earlier turns of the conversation, oldest first,
+	// which Prompt continues as the next user message. A Request without a
+	// Prompt ends with the last of Messages.
+	Messages []Message
+
+	// Structured asks for a typed list of candidates, using the provider's
+	// structured output feature. Providers without one ignore it and answer
+	// with plain text.
+	Structured bool
+}
+
+// conversation returns the messages of r in order, ending with the Prompt.
+func (r Request) conversation() []Message {
+	if r.Prompt == "" {
+		return r.Messages
+	}
+	return append(r.Messages[:len(r.Messages):len(r.Messages)], Message{Role: "user", Content: r.Prompt})
+}
+
+// Response is the result of a Provider.Generate call.
+type Response struct {
+	Text       string      // Raw text, JSON for structured responses
+	Candidates []Candidate // Set when the provider honoured Request.Structured
+	Provider   string      // Name of the provider that produced the response
+}
+
+// Provider is a backend capable of answering a Request, e.g. OpenAI or Anthropic.
+type Provider interface {
+	Name() string
+	Generate(ctx context.Context, req Request) (Response, error)
+}
+
+// StreamingProvider is implemented by providers that can deliver the response
+// incrementally. onText is called with every chunk of text as it arrives; the
+// returned Response holds the complete text.
+type StreamingProvider interface {
+	Provider
+	GenerateStream(ctx context.Context, req Request, onText func(string)) (Response, error)
+}
+
+// ProviderFactory creates a Provider, typically reading its configuration from the environment.
+type ProviderFactory func() (Provider, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]ProviderFactory{}
+)
+
+// RegisterProvider makes a provider available under the given MODEL_PROVIDER name.
+// Registering the same name twice replaces the previous factory.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if factory == nil {
+		panic("aico: RegisterProvider factory is nil")
+	}
+	providers[name] = factory
+}
+
+// NewProvider creates the provider registered under name.
+func NewProvider(name string) (Provider, error) {
+	providersMu.RLock()
+	factory, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown model provider: %s (supported providers: %v)", name, Providers())
+	}
+	return factory()
+}
+
+// Providers returns the sorted names of all registered providers.
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
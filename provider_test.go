@@ -0,0 +1,57 @@
+package aico
+
+import (
+	"context"
+	"testing"
+)
+
+type fakeProvider struct {
+	text string
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) Generate(ctx context.Context, r Request) (Response, error) {
+	return Response{Text: p.text, Provider: p.Name()}, nil
+}
+
+func TestRegisterProvider(t *testing.T) {
+	RegisterProvider("fake", func() (Provider, error) {
+		return &fakeProvider{text: "test response"}, nil
+	})
+
+	p, err := NewProvider("fake")
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	resp, err := p.Generate(context.Background(), Request{Prompt: "test question"})
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if resp.Text != "test response" || resp.Provider != "fake" {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+
+	found := false
+	for _, name := range Providers() {
+		if name == "fake" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected fake in Providers(), got %v", Providers())
+	}
+}
+
+func TestNewProviderUnknown(t *testing.T) {
+	if _, err := NewProvider("does-not-exist"); err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
+
+func TestNewProviderMissingKey(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	if _, err := NewProvider("openai"); err == nil {
+		t.Error("Expected an error for missing OPENAI_API_KEY, got nil")
+	}
+}
@@ -0,0 +1,227 @@
+package aico
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactFile is the name of the file, in the root of the repository, that
+// lists additional regular expressions of secrets, one per line.
+const RedactFile = ".aicoredact"
+
+// Redaction is a secret replaced by Redactor.Redact.
+type Redaction struct {
+	Detector string // Name of the detector that found the secret
+	Line     int    // 1-based line number in the diff
+}
+
+// Redactor replaces secrets in a diff before it is sent to a provider.
+type Redactor struct {
+	detectors []secretDetector
+}
+
+type secretDetector struct {
+	name string
+	re   *regexp.Regexp // The first group, if any, is the secret; otherwise the whole match
+	// accept filters the matches of re, e.g. by their entropy; nil accepts all
+	accept func(secret string) bool
+}
+
+// builtinDetectors find well-known credential formats. Private key blocks
+// spanning several lines are handled by Redact itself.
+var builtinDetectors = []secretDetector{
+	{name: "aws-access-key-id", re: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{name: "aws-secret-access-key", re: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]+\s*["']?([A-Za-z0-9/+=]{40})\b`)},
+	{name: "github-token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{name: "dotenv-secret", re: regexp.MustCompile(`^\s*(?:export\s+)?[A-Z0-9_]*(?:PASSWORD|PASSWD|SECRET|TOKEN|API_KEY|APIKEY|PRIVATE_KEY)[A-Z0-9_]*\s*=\s*["']?([^\s"'$]{8,})`)},
+	{name: "high-entropy-string", re: regexp.MustCompile(`[A-Za-z0-9+/_=-]{24,}`), accept: highEntropy},
+}
+
+var (
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	privateKeyEnd   = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	// privateKeyBody matches a base64 line of a PEM key
+	privateKeyBody = regexp.MustCompile(`^[A-Za-z0-9+/]{16,}={0,2}$`)
+)
+
+// NewRedactor returns a Redactor using the built-in detectors and the given
+// regular expressions. An expression with a capturing group only redacts the
+// text of its first group, e.g. `password: "([^"]+)"`.
+func NewRedactor(patterns []string) (*Redactor, error) {
+	r := &Redactor{detectors: append([]secretDetector(nil), builtinDetectors...)}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		r.detectors = append(r.detectors, secretDetector{name: "custom", re: re})
+	}
+	return r, nil
+}
+
+// LoadRedactor returns a Redactor using the built-in detectors and the
+// expressions of the RedactFile in the repository root, if there is one.
+// Blank lines and lines starting with "#" are skipped.
+func LoadRedactor(root string) (*Redactor, error) {
+	f, err := os.Open(filepath.Join(root, RedactFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewRedactor(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := regexp.Compile(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", RedactFile, n, err)
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", RedactFile, err)
+	}
+	return NewRedactor(patterns)
+}
+
+// Redact replaces the secrets found in the changed and context lines of a
+// git diff with "[REDACTED:<detector>]" and reports where they were. The
+// lines of the diff are kept, so that it can still be parsed.
+func (r *Redactor) Redact(diff string) (string, []Redaction) {
+	var redactions []Redaction
+	lines := strings.Split(diff, "\n")
+	inHunk, inKey, hunkStart := false, false, false
+	for i, line := range lines {
+		// A key lasts until its END line, which may be in a later hunk of the file
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			inHunk, inKey = false, false
+			continue
+		case strings.HasPrefix(line, "@@"):
+			inHunk, hunkStart = true, true
+			continue
+		case !inHunk || line == "":
+			continue
+		}
+
+		// The first character of a hunk line is its " ", "+" or "-" marker
+		marker, content := line[:1], line[1:]
+
+		// A hunk may start in the middle of a key whose BEGIN line is not shown
+		if hunkStart && !inKey && privateKeyBody.MatchString(content) {
+			inKey = true
+			redactions = append(redactions, Redaction{Detector: "private-key", Line: i + 1})
+		}
+		hunkStart = false
+
+		if inKey {
+			if privateKeyEnd.MatchString(content) {
+				inKey = false
+			} else {
+				lines[i] = marker + "[REDACTED:private-key]"
+			}
+			continue
+		}
+		if privateKeyBegin.MatchString(content) && !privateKeyEnd.MatchString(content) {
+			inKey = true
+			redactions = append(redactions, Redaction{Detector: "private-key", Line: i + 1})
+			continue
+		}
+
+		for _, d := range r.detectors {
+			var found int
+			content, found = d.redact(content)
+			for ; found > 0; found-- {
+				redactions = append(redactions, Redaction{Detector: d.name, Line: i + 1})
+			}
+		}
+		lines[i] = marker + content
+	}
+	return strings.Join(lines, "\n"), redactions
+}
+
+// redact replaces the secrets found by d in line and returns their number.
+func (d secretDetector) redact(line string) (string, int) {
+	var b strings.Builder
+	found, last := 0, 0
+	for _, m := range d.re.FindAllStringSubmatchIndex(line, -1) {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		secret := line[start:end]
+		if secret == "" || strings.Contains(secret, "[REDACTED:") || (d.accept != nil && !d.accept(secret)) {
+			continue
+		}
+		b.WriteString(line[last:start])
+		b.WriteString("[REDACTED:" + d.name + "]")
+		last = end
+		found++
+	}
+	if found == 0 {
+		return line, 0
+	}
+	b.WriteString(line[last:])
+	return b.String(), found
+}
+
+// highEntropy reports whether s looks like a random token: it mixes upper
+// and lower case letters with digits, and its Shannon entropy is high.
+// Identifiers and hexadecimal hashes fail the first test.
+func highEntropy(s string) bool {
+	var upper, lower, digit bool
+	counts := map[rune]int{}
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+		counts[c]++
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	entropy := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= 4.0
+}
+
+// SummarizeRedactions describes redactions by detector, e.g.
+// "2 aws-access-key-id, 1 private-key".
+func SummarizeRedactions(redactions []Redaction) string {
+	counts := map[string]int{}
+	for _, r := range redactions {
+		counts[r.Detector]++
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%d %s", counts[name], name)
+	}
+	return strings.Join(parts, ", ")
+}
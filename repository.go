@@ -0,0 +1,24 @@
+package aico
+
+// Repository is the git repository whose staged changes are committed.
+type Repository interface {
+	// StagedDiff returns the unified diff of the index against HEAD, like
+	// `git diff --staged`.
+	StagedDiff() (string, error)
+	// StagedFiles returns the paths of the staged files relative to the
+	// root, like `git diff --staged --name-only`.
+	StagedFiles() ([]string, error)
+	// Commit records the staged changes with the given message.
+	Commit(message string) error
+	// Log returns the messages of the last n commits of the current branch,
+	// newest first.
+	Log(n int) ([]string, error)
+	// CurrentBranch returns the short name of the checked out branch, or
+	// "HEAD" when it is detached.
+	CurrentBranch() (string, error)
+	// Root returns the top-level directory of the working tree.
+	Root() (string, error)
+	// Config returns the value of a configuration variable such as
+	// "core.editor", or "" if it is not set.
+	Config(key string) (string, error)
+}
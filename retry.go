@@ -0,0 +1,225 @@
+package aico
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrAuth is matched by errors.Is for API errors caused by a missing,
+	// invalid or unauthorized API key. Retrying does not help.
+	ErrAuth = errors.New("authentication failed")
+
+	// ErrRateLimited is matched by errors.Is for HTTP 429 responses.
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrOverloaded is matched by errors.Is when the provider is temporarily
+	// out of capacity, e.g. Anthropic's 529 "overloaded" status.
+	ErrOverloaded = errors.New("provider overloaded")
+)
+
+// APIError is returned when a provider answers with a non-OK HTTP status.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Status     string
+	Body       string
+	RetryAfter time.Duration // Parsed from the Retry-After header, 0 if absent
+}
+
+func newAPIError(provider string, resp *http.Response, body []byte) *APIError {
+	return &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("received non-OK HTTP status from %s: %s, response body: %s", e.Provider, e.Status, e.Body)
+}
+
+// Is makes errors.Is(err, ErrAuth), ErrRateLimited and ErrOverloaded work.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrAuth:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrOverloaded:
+		return e.StatusCode == 529 || e.StatusCode == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// Transient reports whether the request may succeed when retried.
+func (e *APIError) Transient() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode >= 500
+}
+
+// IsTransient reports whether err is worth retrying: a 429 or 5xx API error,
+// or a network error. Cancellation of the caller's context is not transient.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Transient()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// RetryPolicy controls how transient failures are retried.
+type RetryPolicy struct {
+	MaxAttempts int           // Total number of attempts, including the first
+	BaseDelay   time.Duration // Delay before the first retry, doubled on every further retry
+	MaxDelay    time.Duration // Upper bound of the backoff delay and of the delay requested by the server
+	Timeout     time.Duration // Limit of each attempt, 0 for none. A timed out attempt is not retried.
+}
+
+// delay returns the jittered backoff before the given retry (1 for the first),
+// or the delay requested by the server with Retry-After. Both are limited to
+// MaxDelay, so that a server asking for an hour does not stall the command.
+func (p RetryPolicy) delay(retry int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if p.MaxDelay > 0 && apiErr.RetryAfter > p.MaxDelay {
+			return p.MaxDelay
+		}
+		return apiErr.RetryAfter
+	}
+	d := p.BaseDelay << (retry - 1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	// Equal jitter: wait between half and the full backoff
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// WithRetry wraps p so that transient failures are retried according to
+// policy. Streamed responses are only retried until the first text arrives.
+func WithRetry(p Provider, policy RetryPolicy) Provider {
+	if policy.MaxAttempts <= 1 && policy.Timeout <= 0 {
+		return p
+	}
+	r := &retryProvider{Provider: p, policy: policy, sleep: sleepContext}
+	if sp, ok := p.(StreamingProvider); ok {
+		return &retryStreamingProvider{retryProvider: r, streaming: sp}
+	}
+	return r
+}
+
+type retryProvider struct {
+	Provider
+	policy RetryPolicy
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+// Generate implements Provider.
+func (p *retryProvider) Generate(ctx context.Context, r Request) (Response, error) {
+	return p.do(ctx, r, func() (Response, bool, error) {
+		ctx, cancel := p.attemptContext(ctx)
+		defer cancel()
+		resp, err := p.Provider.Generate(ctx, r)
+		return resp, true, err
+	})
+}
+
+// MaxPromptTokens implements TokenLimits.
+func (p *retryProvider) MaxPromptTokens() int {
+	return LimitsOf(p.Provider).MaxPromptTokens()
+}
+
+// EstimateTokens implements TokenLimits.
+func (p *retryProvider) EstimateTokens(text string) int {
+	return LimitsOf(p.Provider).EstimateTokens(text)
+}
+
+// attemptContext returns the context of a single attempt.
+func (p *retryProvider) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.policy.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, p.policy.Timeout)
+}
+
+// do calls attempt until it succeeds, fails permanently or runs out of
+// attempts. attempt reports whether a failure may be retried.
+func (p *retryProvider) do(ctx context.Context, r Request, attempt func() (Response, bool, error)) (Response, error) {
+	for i := 1; ; i++ {
+		resp, retryable, err := attempt()
+		if err == nil || !retryable || !IsTransient(err) || i >= p.policy.MaxAttempts {
+			return resp, err
+		}
+		d := p.policy.delay(i, err)
+		if r.Verbose {
+			fmt.Printf("\nAttempt %d/%d with %s failed, retrying in %s: %v\n", i, p.policy.MaxAttempts, p.Name(), d.Round(time.Millisecond), err)
+		}
+		if err := p.sleep(ctx, d); err != nil {
+			return Response{}, err
+		}
+	}
+}
+
+type retryStreamingProvider struct {
+	*retryProvider
+	streaming StreamingProvider
+}
+
+// GenerateStream implements StreamingProvider.
+func (p *retryStreamingProvider) GenerateStream(ctx context.Context, r Request, onText func(string)) (Response, error) {
+	return p.do(ctx, r, func() (Response, bool, error) {
+		ctx, cancel := p.attemptContext(ctx)
+		defer cancel()
+		received := false
+		resp, err := p.streaming.GenerateStream(ctx, r, func(text string) {
+			received = true
+			onText(text)
+		})
+		// Text already shown to the user cannot be taken back
+		return resp, !received, err
+	})
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
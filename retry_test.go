@@ -0,0 +1,126 @@
+package aico
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(529)
+			w.Write([]byte(`{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`))
+			return
+		}
+		w.Write([]byte(`{"content": [{"type": "text", "text": "test response"}]}`))
+	}))
+	defer server.Close()
+
+	p := WithRetry(&AnthropicProvider{URL: server.URL, Key: "test-key"}, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	resp, err := p.Generate(context.Background(), Request{Prompt: "test question"})
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if resp.Text != "test response" {
+		t.Errorf("Expected response to be 'test response', got: %s", resp.Text)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestWithRetryGivesUp(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		maxAttempts  int
+		wantAttempts int
+		wantIs       error
+	}{
+		{"auth failure is not retried", http.StatusUnauthorized, 3, 1, ErrAuth},
+		{"rate limit retried until max attempts", http.StatusTooManyRequests, 2, 2, ErrRateLimited},
+		{"overloaded retried until max attempts", 529, 3, 3, ErrOverloaded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			p := WithRetry(&OpenAIProvider{URL: server.URL, Key: "test-key"}, RetryPolicy{MaxAttempts: tt.maxAttempts, BaseDelay: time.Millisecond})
+			_, err := p.Generate(context.Background(), Request{Prompt: "test question"})
+			if !errors.Is(err, tt.wantIs) {
+				t.Errorf("Expected errors.Is(err, %v), got: %v", tt.wantIs, err)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.wantAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestWithRetryStreamAfterText(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"delta\": {\"type\": \"text_delta\", \"text\": \"- Add\"}}\n\n" +
+			"event: error\ndata: {\"type\": \"error\", \"error\": {\"type\": \"overloaded_error\", \"message\": \"Overloaded\"}}\n\n"))
+	}))
+	defer server.Close()
+
+	p := WithRetry(&AnthropicProvider{URL: server.URL, Key: "test-key"}, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	sp, ok := p.(StreamingProvider)
+	if !ok {
+		t.Fatal("Expected the retrying provider to keep streaming support")
+	}
+	_, err := sp.GenerateStream(context.Background(), Request{Prompt: "test question"}, func(string) {})
+	if !errors.Is(err, ErrOverloaded) {
+		t.Errorf("Expected errors.Is(err, ErrOverloaded), got: %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected no retry once text was delivered, got %d attempts", attempts)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+	tests := []struct {
+		retryAfter time.Duration
+		expected   time.Duration
+	}{
+		{7 * time.Second, 7 * time.Second},
+		{time.Hour, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		err := &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: tt.retryAfter}
+		if d := policy.delay(1, err); d != tt.expected {
+			t.Errorf("delay() with Retry-After %s = %s, want %s", tt.retryAfter, d, tt.expected)
+		}
+	}
+	if d := policy.delay(10, errors.New("connection reset")); d < 15*time.Second || d > 30*time.Second {
+		t.Errorf("Expected the backoff to be limited to 30s, got %s", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("7"); d != 7*time.Second {
+		t.Errorf("Expected 7s, got %s", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); d <= 50*time.Second || d > time.Minute {
+		t.Errorf("Expected about 1m, got %s", d)
+	}
+	if d := parseRetryAfter("soon"); d != 0 {
+		t.Errorf("Expected 0, got %s", d)
+	}
+}
@@ -0,0 +1,106 @@
+package aico
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// InferScope derives a commit scope from the paths of the staged files,
+// relative to the repository root:
+//
+//   - the scope that mapping assigns to all of them, where a key of mapping is
+//     a path prefix such as "services/billing" and the longest one wins
+//   - otherwise the name of the Go package in their closest common
+//     directory, unless it is "main"
+//   - otherwise the name of that directory
+//
+// Go files directly in the root give the name of their package. Otherwise
+// "" is returned when the files have no common directory below the root.
+func InferScope(root string, files []string, mapping map[string]string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	if scope := mappedScope(files, mapping); scope != "" {
+		return scope
+	}
+
+	dir := commonDir(files)
+	if dir == "" && !allGoFiles(files) {
+		return ""
+	}
+	if name := goPackageName(filepath.Join(root, filepath.FromSlash(dir))); name != "" && name != "main" {
+		return name
+	}
+	if dir == "" {
+		return ""
+	}
+	return path.Base(dir)
+}
+
+func allGoFiles(files []string) bool {
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".go") {
+			return false
+		}
+	}
+	return true
+}
+
+// mappedScope returns the scope mapping assigns to every file, or "".
+func mappedScope(files []string, mapping map[string]string) string {
+	scope := ""
+	for _, file := range files {
+		s, longest := "", -1
+		for prefix, v := range mapping {
+			prefix = strings.Trim(prefix, "/")
+			if (file == prefix || strings.HasPrefix(file, prefix+"/")) && len(prefix) > longest {
+				s, longest = v, len(prefix)
+			}
+		}
+		if s == "" || (scope != "" && s != scope) {
+			return ""
+		}
+		scope = s
+	}
+	return scope
+}
+
+// commonDir returns the deepest directory containing all files, "" for the root.
+func commonDir(files []string) string {
+	dir := path.Dir(files[0])
+	for _, file := range files[1:] {
+		for dir != "." && !strings.HasPrefix(file, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// goPackageName returns the package name of the Go files in dir, ignoring
+// external test packages, or "" if there are none.
+func goPackageName(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, e.Name()), nil, parser.PackageClauseOnly)
+		if err != nil {
+			continue
+		}
+		if name := f.Name.Name; !strings.HasSuffix(name, "_test") {
+			return name
+		}
+	}
+	return ""
+}
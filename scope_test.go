@@ -0,0 +1,55 @@
+package aico
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInferScope(t *testing.T) {
+	root := t.TempDir()
+	for path, content := range map[string]string{
+		"pkg/v2/client.go":      "package client\n",
+		"pkg/v2/client_test.go": "package client_test\n",
+		"cmd/tool/main.go":      "package main\n",
+		"lib.go":                "package aico\n",
+	} {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mapping := map[string]string{
+		"services/billing":     "billing",
+		"services/billing/api": "billing-api",
+		"web/":                 "frontend",
+	}
+
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"Go package name", []string{"pkg/v2/client.go", "pkg/v2/client_test.go"}, "client"},
+		{"main package uses the directory", []string{"cmd/tool/main.go"}, "tool"},
+		{"common directory", []string{"docs/guide/a.md", "docs/guide/img/b.png"}, "guide"},
+		{"common parent directory", []string{"docs/guide/a.md", "docs/api/b.md"}, "docs"},
+		{"Go files in the root", []string{"lib.go"}, "aico"},
+		{"nothing in common", []string{"README.md", "pkg/v2/client.go"}, ""},
+		{"mapping", []string{"web/src/app.ts", "web/index.html"}, "frontend"},
+		{"longest prefix of the mapping", []string{"services/billing/api/handler.go"}, "billing-api"},
+		{"mapping is not a partial directory name", []string{"services/billingx/a.go"}, "billingx"},
+		{"mixed mapping falls back", []string{"services/billing/a.go", "services/billing/api/b.go"}, "billing"},
+		{"no files", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InferScope(root, tt.files, mapping); got != tt.want {
+				t.Errorf("InferScope(%q) = %q, want %q", tt.files, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package aico
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SplitDiff groups the files of a diff into chunks of at most maxTokens
+// tokens as estimated by estimate. A file that does not fit into a chunk on
+// its own is split between its hunks, and a single hunk that is still too
+// large is truncated with TruncateDiff.
+func SplitDiff(diff string, maxTokens int, estimate func(string) int) []string {
+	var chunks []string
+	var current strings.Builder
+	currentTokens := 0
+	add := func(text string, tokens int) {
+		if currentTokens > 0 && currentTokens+tokens > maxTokens {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			currentTokens = 0
+		}
+		current.WriteString(text)
+		currentTokens += tokens
+	}
+
+	for _, f := range ParseDiff(diff) {
+		text := f.String()
+		if tokens := estimate(text); tokens <= maxTokens {
+			add(text, tokens)
+			continue
+		}
+
+		// Split the file between its hunks, repeating the header in every part
+		header := strings.Join(f.Header, "\n") + "\n"
+		part := FileDiff{Path: f.Path, Header: f.Header}
+		flush := func() {
+			if len(part.Hunks) > 0 {
+				text := part.String()
+				add(text, estimate(text))
+				part.Hunks = nil
+			}
+		}
+		for _, h := range f.Hunks {
+			hunk := h.String()
+			if estimate(header+hunk) > maxTokens {
+				flush()
+				truncated := TruncateDiff(header+hunk, maxTokens, estimate)
+				add(truncated.Diff, truncated.Tokens)
+				continue
+			}
+			if estimate(part.String()+hunk) > maxTokens {
+				flush()
+			}
+			part.Hunks = append(part.Hunks, h)
+		}
+		flush()
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+// SummarizeDiff is the map step for diffs too large for a single prompt: the
+// diff is split into chunks that fit the provider's context window, each chunk
+// is summarised by the provider with at most workers requests at a time, and
+// the summaries are returned in diff order, ready to take the place of the
+// diff in the commit message prompt.
+func SummarizeDiff(ctx context.Context, p Provider, diff string, workers int, verbose bool) (string, error) {
+	limits := LimitsOf(p)
+	maxTokens := limits.MaxPromptTokens() - limits.EstimateTokens(CreateSummaryQuestion(""))
+	chunks := SplitDiff(diff, maxTokens, limits.EstimateTokens)
+	if verbose {
+		fmt.Printf("\nSummarising the diff in %d chunks with %d workers\n", len(chunks), workers)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	summaries := make([]string, len(chunks))
+	var mu sync.Mutex
+	var firstErr error
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel() // The commit message would be based on an incomplete picture
+	}
+
+	sem := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				fail(ctx.Err())
+				return
+			}
+
+			resp, err := p.Generate(ctx, Request{Prompt: CreateSummaryQuestion(chunk), Verbose: verbose})
+			if err != nil {
+				fail(fmt.Errorf("summarising part %d of %d: %w", i+1, len(chunks), err))
+				return
+			}
+			summaries[i] = strings.TrimSpace(resp.Text)
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	var b strings.Builder
+	b.WriteString("The diff is too large to include; these are summaries of its parts:\n")
+	for i, summary := range summaries {
+		fmt.Fprintf(&b, "\n# Part %d of %d\n%s\n", i+1, len(summaries), summary)
+	}
+	b.WriteString("\nFiles changed (git diff --stat):\n")
+	b.WriteString(DiffStat(ParseDiff(diff)))
+	return b.String(), nil
+}
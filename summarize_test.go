@@ -0,0 +1,99 @@
+package aico
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// summaryProvider answers every request with the paths of the files in it,
+// tracking how many requests run at the same time.
+type summaryProvider struct {
+	mu         sync.Mutex
+	running    int
+	maxRunning int
+	fail       bool
+}
+
+func (p *summaryProvider) Name() string { return "summary" }
+
+func (p *summaryProvider) MaxPromptTokens() int { return 400 }
+
+func (p *summaryProvider) EstimateTokens(text string) int { return len(text) / 4 }
+
+func (p *summaryProvider) Generate(ctx context.Context, r Request) (Response, error) {
+	p.mu.Lock()
+	p.running++
+	p.maxRunning = max(p.maxRunning, p.running)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.running--
+		p.mu.Unlock()
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	if p.fail {
+		return Response{}, errors.New("test error")
+	}
+	var paths []string
+	for _, f := range ParseDiff(r.Prompt[strings.Index(r.Prompt, "diff --git"):]) {
+		paths = append(paths, f.Path)
+	}
+	return Response{Text: "- changed " + strings.Join(paths, ", ")}, nil
+}
+
+func largeTestDiff(files int) string {
+	var b strings.Builder
+	for i := 0; i < files; i++ {
+		fmt.Fprintf(&b, "diff --git a/file%02d.go b/file%02d.go\n--- a/file%02d.go\n+++ b/file%02d.go\n@@ -1,1 +1,1 @@\n", i, i, i, i)
+		for j := 0; j < 20; j++ {
+			fmt.Fprintf(&b, "+line %d of file %d\n", j, i)
+		}
+	}
+	return b.String()
+}
+
+func TestSplitDiff(t *testing.T) {
+	estimate := func(text string) int { return len(text) / 4 }
+	diff := largeTestDiff(10)
+
+	chunks := SplitDiff(diff, 300, estimate)
+	if len(chunks) < 2 {
+		t.Fatalf("Expected several chunks, got %d", len(chunks))
+	}
+	if strings.Join(chunks, "") != diff {
+		t.Error("Expected the chunks to add up to the diff")
+	}
+	for i, chunk := range chunks {
+		if estimate(chunk) > 300 {
+			t.Errorf("Chunk %d exceeds the limit: %d tokens", i, estimate(chunk))
+		}
+	}
+}
+
+func TestSummarizeDiff(t *testing.T) {
+	p := &summaryProvider{}
+	summary, err := SummarizeDiff(context.Background(), p, largeTestDiff(20), 3, false)
+	if err != nil {
+		t.Fatal("Expected no error, got:", err)
+	}
+	if p.maxRunning > 3 {
+		t.Errorf("Expected at most 3 concurrent requests, got %d", p.maxRunning)
+	}
+	if !strings.Contains(summary, "changed file00.go") || !strings.Contains(summary, "file19.go | 20") {
+		t.Errorf("Unexpected summary:\n%s", summary)
+	}
+	if strings.Index(summary, "file00.go,") > strings.Index(summary, "file19.go") {
+		t.Error("Expected the summaries in diff order")
+	}
+
+	p = &summaryProvider{fail: true}
+	if _, err := SummarizeDiff(context.Background(), p, largeTestDiff(20), 3, false); err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
@@ -0,0 +1,105 @@
+package aico
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultContextWindow is assumed for models that are not in modelLimits.
+const defaultContextWindow = 8192
+
+// modelLimit describes a model family, matched by name prefix.
+type modelLimit struct {
+	prefix        string
+	contextWindow int
+	charsPerToken float64 // Average for source code and English text
+}
+
+// modelLimits lists known model families. More specific prefixes come first.
+var modelLimits = []modelLimit{
+	{"gpt-4o", 128000, 4.0},
+	{"gpt-4.1", 1047576, 4.0},
+	{"gpt-4-turbo", 128000, 3.7},
+	{"gpt-4-32k", 32768, 3.7},
+	{"gpt-4", 8192, 3.7},
+	{"gpt-3.5-turbo", 16385, 3.7},
+	{"o1", 200000, 4.0},
+	{"o3", 200000, 4.0},
+	{"o4", 200000, 4.0},
+	{"claude", 200000, 3.5},
+	{"gemini-1.5", 1048576, 4.0},
+	{"gemini", 1048576, 4.0},
+	{"llama3.1", 131072, 3.6},
+	{"llama3.2", 131072, 3.6},
+	{"llama3", 8192, 3.6},
+	{"qwen2.5", 32768, 3.4},
+	{"mistral", 32768, 3.4},
+}
+
+func lookupModel(model string) modelLimit {
+	model = strings.ToLower(model)
+	// Ollama and gateway names such as "library/llama3.1:8b" or "openai/gpt-4o"
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	for _, m := range modelLimits {
+		if strings.HasPrefix(model, m.prefix) {
+			return m
+		}
+	}
+	return modelLimit{contextWindow: defaultContextWindow, charsPerToken: 3.5}
+}
+
+// ContextWindow returns the number of tokens the model accepts for prompt and
+// response together, or a conservative default for unknown models.
+func ContextWindow(model string) int {
+	return lookupModel(model).contextWindow
+}
+
+// EstimateTokens estimates the number of tokens text takes up for the model.
+// Non-ASCII characters, e.g. Japanese, are counted as a token each, which
+// errs on the safe side for most tokenizers.
+func EstimateTokens(model, text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return int(float64(ascii)/lookupModel(model).charsPerToken+0.5) + other
+}
+
+// TokenLimits is implemented by providers that know the limits of their model,
+// so that prompts can be fitted into its context window.
+type TokenLimits interface {
+	// MaxPromptTokens returns how many tokens the prompt may take up,
+	// leaving room for the response.
+	MaxPromptTokens() int
+	// EstimateTokens estimates the number of tokens text takes up.
+	EstimateTokens(text string) int
+}
+
+// LimitsOf returns the token limits of p. Providers that do not implement
+// TokenLimits are assumed to use a model with the default context window.
+func LimitsOf(p Provider) TokenLimits {
+	if l, ok := p.(TokenLimits); ok {
+		return l
+	}
+	return modelTokenLimits{}
+}
+
+// modelTokenLimits implements TokenLimits for a model name.
+type modelTokenLimits struct {
+	model     string
+	maxTokens int // Reserved for the response
+}
+
+func (l modelTokenLimits) MaxPromptTokens() int {
+	return ContextWindow(l.model) - l.maxTokens
+}
+
+func (l modelTokenLimits) EstimateTokens(text string) int {
+	return EstimateTokens(l.model, text)
+}